@@ -6,11 +6,17 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"runtime"
 	"strings"
+	"time"
 	"todo"
 )
 
-var todoFileName = ".todo.json"
+var (
+	todoFileName    = ".todo.json"
+	archiveFileName = ".todo.archive.json"
+)
 
 func main() {
 	// Parsing command line flags
@@ -18,12 +24,53 @@ func main() {
 	list := flag.Bool("list", false, "List all tasks")
 	complete := flag.Int("complete", -1, "ID of task to be completed")
 	delete := flag.Int("delete", -1, "ID of task to be deleted")
+	archive := flag.Bool("archive", false, "Move completed tasks older than -age to the archive")
+	age := flag.Duration("age", 14*24*time.Hour, "How long ago a task must have been completed to be archived")
+	archived := flag.Bool("archived", false, "Use with -list to list archived tasks, or with -search to also search them")
+	restore := flag.Int("restore", -1, "ID of archived task to be restored")
+	priority := flag.Int("priority", 0, "Use with -add to set the priority of the new task")
+	deadline := flag.String("deadline", "", "Use with -add to set a deadline, as YYYY-MM-DD, RFC3339 or a duration from now")
+	layout := flag.String("layout", todo.LayoutDefault, "List layout: default, table, compact or json")
+	format := flag.String("format", "", "text/template used to print each task, overrides -layout")
+	color := flag.String("color", "auto", "Color output: auto, always or never")
+	due := flag.Bool("due", false, "List tasks due within -within, exits 0 if any, 2 if none")
+	within := flag.Duration("within", 24*time.Hour, "Use with -due to set how far ahead to look")
+	summary := flag.Bool("summary", false, "Use with -due to print a one-line summary for shell prompts")
+	notifyCmd := flag.String("notify-cmd", "", "Use with -due to run a shell command once for each newly overdue task")
+	note := flag.String("note", "", "Use with -add to attach notes to the new task")
+	var tags stringList
+	flag.Var(&tags, "tag", "Use with -add to tag the new task, can be repeated")
+	search := flag.String("search", "", "Search tasks, notes and tags for a pattern, exits 0 if found, 2 if not")
+	regex := flag.Bool("regex", false, "Use with -search to treat the pattern as a regular expression")
+	ignoreCase := flag.Bool("ignore-case", false, "Use with -search to ignore letter case")
 	flag.Parse()
 
-	// Set the environment var
+	// Set the environment vars
 	if os.Getenv("TODO_FILENAME") != "" {
 		todoFileName = os.Getenv("TODO_FILENAME")
 	}
+	if os.Getenv("TODO_ARCHIVE_FILENAME") != "" {
+		archiveFileName = os.Getenv("TODO_ARCHIVE_FILENAME")
+	}
+	if *format == "" {
+		*format = os.Getenv("TODO_FORMAT")
+	}
+	if *notifyCmd == "" {
+		*notifyCmd = os.Getenv("TODO_NOTIFY_CMD")
+	}
+
+	// Decide how lists are printed
+	opts := todo.RenderOptions{Layout: *layout, Format: *format}
+	switch *color {
+	case "auto":
+		opts.Color = todo.ColorEnabled(os.Stdout)
+	case "always":
+		opts.Color = true
+	case "never":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid color mode %q\n", *color)
+		os.Exit(1)
+	}
 
 	// Create an item list
 	l := &todo.List{}
@@ -34,10 +81,113 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Create the archive list, it is only read from disk when needed
+	a := &todo.List{}
+
 	// Decide how to handle given args
 	switch {
+	case *list && *archived:
+		if err := a.Get(archiveFileName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		printList(a, opts)
 	case *list:
-		l.Print()
+		printList(l, opts)
+	case *search != "":
+		searchOpts := todo.SearchOptions{Regex: *regex, IgnoreCase: *ignoreCase}
+		found, err := printSearch(l, "", *search, searchOpts, opts.Color)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *archived {
+			if err := a.Get(archiveFileName); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			foundArchived, err := printSearch(a, "archived ", *search, searchOpts, opts.Color)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			found += foundArchived
+		}
+		if found == 0 {
+			os.Exit(2)
+		}
+	case *due:
+		now := time.Now()
+		if *notifyCmd != "" {
+			notified := false
+			for _, i := range l.NewlyOverdue(now) {
+				if err := notify(*notifyCmd, i.Id, i.Task, i.Due); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					continue
+				}
+				l.MarkNotified(i.Id, now)
+				notified = true
+			}
+			// Only write the file when something changed, keeping the check fast
+			if notified {
+				if err := l.Save(todoFileName); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+		}
+		dueList := l.DueWithin(*within, now)
+		if *summary {
+			if s := l.DueSummary(*within, now); s != "" {
+				fmt.Println(s)
+			}
+		} else {
+			printList(&dueList, opts)
+		}
+		// The exit code tells scripts whether anything needs attention
+		if len(dueList) == 0 {
+			os.Exit(2)
+		}
+	case *archive:
+		if err := a.Get(archiveFileName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		n := l.Archive(a, *age)
+		// Save the archive first so a failure can't lose tasks
+		if err := a.Save(archiveFileName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := l.Save(todoFileName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		} else {
+			fmt.Printf("Successfully archived %d tasks\n", n)
+			printList(l, opts)
+		}
+	case *restore >= 0:
+		if err := a.Get(archiveFileName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		restored, err := l.Restore(a, *restore)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// Save the list first so a failure can't lose tasks
+		if err := l.Save(todoFileName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := a.Save(archiveFileName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		} else {
+			fmt.Printf("Successfully restored task %d as task %d\n", *restore, restored.Id)
+			printList(l, opts)
+		}
 	case *complete >= 0:
 		// Complete the specified item
 		if err := l.Complete(*complete); err != nil {
@@ -52,7 +202,7 @@ func main() {
 			os.Exit(1)
 		} else {
 			fmt.Printf("Successfully saved updated list\n")
-			l.Print()
+			printList(l, opts)
 		}
 	// Check the default task string was fixed
 	case *add:
@@ -63,14 +213,31 @@ func main() {
 			os.Exit(1)
 		}
 		// Add the task
-		l.Add(t)
+		added := l.Add(t)
+		if *priority != 0 {
+			l.SetPriority(added.Id, *priority)
+		}
+		if *deadline != "" {
+			due, err := parseDeadline(*deadline, time.Now())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			l.SetDue(added.Id, due)
+		}
+		if *note != "" {
+			l.SetNotes(added.Id, *note)
+		}
+		if len(tags) > 0 {
+			l.SetTags(added.Id, tags...)
+		}
 		// Save the new list
 		if err := l.Save(todoFileName); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		} else {
 			fmt.Printf("Successfully added new task %s\n", t)
-			l.Print()
+			printList(l, opts)
 		}
 	case *delete >= 0:
 		if err := l.Delete(*delete); err != nil {
@@ -85,7 +252,7 @@ func main() {
 			os.Exit(1)
 		} else {
 			fmt.Printf("Successfully saved updated list\n")
-			l.Print()
+			printList(l, opts)
 		}
 	default:
 		// Invalid flag provided
@@ -117,3 +284,80 @@ func getTask(r io.Reader, args ...string) (string, error) {
 	}
 	return s.Text(), nil
 }
+
+// notify runs the user's notification command through the shell, passing
+// the details of the overdue task in the environment
+func notify(command string, id int, task string, due time.Time) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("TODO_ID=%d", id),
+		fmt.Sprintf("TODO_TASK=%s", task),
+		fmt.Sprintf("TODO_DUE=%s", due.Format(time.RFC3339)),
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("notification for task %d failed: %w", id, err)
+	}
+	return nil
+}
+
+// printSearch prints one line per match of the pattern in the list, with the
+// given prefix, and returns the number of matching tasks
+func printSearch(l *todo.List, prefix, pattern string, opts todo.SearchOptions, color bool) (int, error) {
+	results, err := l.Search(pattern, opts)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range results {
+		for _, m := range r.Matches {
+			text := m.Text
+			if color {
+				text = m.Highlight()
+			}
+			fmt.Printf("%s%d %s: %s\n", prefix, r.Id, m.Field, text)
+		}
+	}
+	return len(results), nil
+}
+
+// stringList type collects the values of a flag that can be repeated
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// printList renders the list to stdout, exiting if the layout or
+// template can't be rendered
+func printList(l *todo.List, opts todo.RenderOptions) {
+	if err := l.Render(os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// parseDeadline accepts a date, a full RFC3339 timestamp or a duration
+// relative to now, such as 48h
+func parseDeadline(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("error: Invalid deadline %q", s)
+}
@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,11 +12,19 @@ import (
 )
 
 var (
-	binName  = "todo"
-	fileName = os.Getenv("TODO_FILENAME")
+	binName         = "todo"
+	fileName        = ".todo.json"
+	archiveFileName = ".todo.archive.json"
 )
 
 func TestMain(m *testing.M) {
+	// Match the file names the tool will use
+	if os.Getenv("TODO_FILENAME") != "" {
+		fileName = os.Getenv("TODO_FILENAME")
+	}
+	if os.Getenv("TODO_ARCHIVE_FILENAME") != "" {
+		archiveFileName = os.Getenv("TODO_ARCHIVE_FILENAME")
+	}
 	fmt.Println("Building tool...")
 	// Depending on the OS, give a file ext
 	if runtime.GOOS == "windows" {
@@ -39,6 +48,7 @@ func TestMain(m *testing.M) {
 	fmt.Println("Cleaning up...")
 	os.Remove(binName)
 	os.Remove(fileName)
+	os.Remove(archiveFileName)
 	os.Exit(result)
 }
 
@@ -83,6 +93,39 @@ func TestTodoCLI(t *testing.T) {
 			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
 		}
 	})
+	// Test that completed tasks can be archived and listed
+	t.Run("ArchiveTasks", func(t *testing.T) {
+		cmd := exec.Command(cmdPath, "-archive", "-age", "0s")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "Successfully archived 1 tasks\nToDo list:\n"
+		if expected != string(out) {
+			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
+		}
+		cmd = exec.Command(cmdPath, "-list", "-archived")
+		out, err = cmd.CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = fmt.Sprintf("ToDo list:\n\tTask ID: 0, Task Name: %s, Done: true\n", task)
+		if expected != string(out) {
+			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
+		}
+	})
+	// Test that archived tasks can be restored
+	t.Run("RestoreTask", func(t *testing.T) {
+		cmd := exec.Command(cmdPath, "-restore", "0")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("Successfully restored task 0 as task 0\nToDo list:\n\tTask ID: 0, Task Name: %s, Done: true\n", task)
+		if expected != string(out) {
+			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
+		}
+	})
 	// Fifth test to ensure that we can delete tasks
 	t.Run("DeleteTask", func(t *testing.T) {
 		cmd := exec.Command(cmdPath, "-delete", "0")
@@ -95,6 +138,104 @@ func TestTodoCLI(t *testing.T) {
 			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
 		}
 	})
+	// Test that tasks can be listed with a user supplied template
+	t.Run("ListTasksFormat", func(t *testing.T) {
+		cmd := exec.Command(cmdPath, "-add", "-priority", "2", "-deadline", "2000-01-01", "Formatted Task")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+		cmd = exec.Command(cmdPath, "-list", "-color", "always", "-format", "{{.Task}} p{{.Priority}} {{.Due.Year}}")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "\033[31mFormatted Task p2 2000\033[0m\n"
+		if expected != string(out) {
+			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
+		}
+		cmd = exec.Command(cmdPath, "-delete", "0")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// Test the due check used by shell prompts and notifications
+	t.Run("DueTasks", func(t *testing.T) {
+		// Nothing is due in an empty list
+		cmd := exec.Command(cmdPath, "-due")
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+			t.Fatalf("Expected exit code 2 with nothing due, got %v", err)
+		}
+		cmd = exec.Command(cmdPath, "-add", "-deadline", "-1h", "Late Task")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+		cmd = exec.Command(cmdPath, "-due", "-summary")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "1 overdue\n"
+		if expected != string(out) {
+			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
+		}
+		// The notification command only runs once per overdue task
+		notifyFile := filepath.Join(t.TempDir(), "notified")
+		for i := 0; i < 2; i++ {
+			cmd = exec.Command(cmdPath, "-due", "-summary", "-notify-cmd", "echo \"$TODO_ID $TODO_TASK\" >> "+notifyFile)
+			if err := cmd.Run(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		notified, err := os.ReadFile(notifyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = "0 Late Task\n"
+		if expected != string(notified) {
+			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(notified))
+		}
+		cmd = exec.Command(cmdPath, "-delete", "0")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// Test searching tasks, notes and tags
+	t.Run("SearchTasks", func(t *testing.T) {
+		cmd := exec.Command(cmdPath, "-add", "-note", "ask about Milk prices", "-tag", "shopping", "-tag", "home", "Buy milk")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+		cmd = exec.Command(cmdPath, "-search", "milk", "-ignore-case")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "0 task: Buy milk\n0 notes: ask about Milk prices\n"
+		if expected != string(out) {
+			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
+		}
+		cmd = exec.Command(cmdPath, "-search", "^h", "-regex", "-color", "always")
+		out, err = cmd.CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = "0 tags: \033[1;31mh\033[0mome\n"
+		if expected != string(out) {
+			t.Errorf("Expected:\n\t%q\n Got:\n\t%q\n", expected, string(out))
+		}
+		cmd = exec.Command(cmdPath, "-search", "bread")
+		err = cmd.Run()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+			t.Errorf("Expected exit code 2 with no matches, got %v", err)
+		}
+		cmd = exec.Command(cmdPath, "-delete", "0")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+	})
 	// Fourth test to ensure we can add tasks from stdin
 	t.Run("AddNewTaskFromSTDIN", func(t *testing.T) {
 		task2 := "Some input from STDIN"
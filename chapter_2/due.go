@@ -0,0 +1,110 @@
+package todo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DueWithin Description:
+//
+// - Finds every open item that is overdue or has a deadline
+// before now + within
+//
+// Inputs:
+//
+// - within (time.Duration): how far ahead of now to look for deadlines
+//
+// - now (time.Time): the current time
+//
+// Outputs:
+//
+// - List: matching items, in list order
+func (l *List) DueWithin(within time.Duration, now time.Time) List {
+	limit := now.Add(within)
+	var due List
+	for _, i := range *l {
+		if !i.Done && !i.Due.IsZero() && !i.Due.After(limit) {
+			due = append(due, i)
+		}
+	}
+	return due
+}
+
+// DueSummary Description:
+//
+// - Builds a one-line summary of overdue and upcoming items, short
+// enough to embed in a shell prompt or a tmux status bar
+//
+// Inputs:
+//
+// - within (time.Duration): how far ahead of now to look for deadlines
+//
+// - now (time.Time): the current time
+//
+// Outputs:
+//
+// - string: summary such as "1 overdue, 2 due", empty if nothing is due
+func (l *List) DueSummary(within time.Duration, now time.Time) string {
+	overdue, upcoming := 0, 0
+	for _, i := range l.DueWithin(within, now) {
+		if i.Due.Before(now) {
+			overdue++
+		} else {
+			upcoming++
+		}
+	}
+	var parts []string
+	if overdue > 0 {
+		parts = append(parts, fmt.Sprintf("%d overdue", overdue))
+	}
+	if upcoming > 0 {
+		parts = append(parts, fmt.Sprintf("%d due", upcoming))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// NewlyOverdue Description:
+//
+// - Finds every open item whose deadline has passed and that has not
+// been notified about yet
+//
+// Inputs:
+//
+// - now (time.Time): the current time
+//
+// Outputs:
+//
+// - List: items to notify about, in list order
+func (l *List) NewlyOverdue(now time.Time) List {
+	var overdue List
+	for _, i := range *l {
+		if !i.Done && !i.Due.IsZero() && i.Due.Before(now) && i.NotifiedAt.IsZero() {
+			overdue = append(overdue, i)
+		}
+	}
+	return overdue
+}
+
+// MarkNotified Description:
+//
+// - Records that an overdue notification was sent for an item, so
+// NewlyOverdue won't return it again
+//
+// Inputs:
+//
+// - id (int): ID of task that was notified about
+//
+// - now (time.Time): time the notification was sent
+//
+// Outputs:
+//
+// - error (fmt.Errorf | nil): error if ID is not found, else nil
+func (l *List) MarkNotified(id int, now time.Time) error {
+	idx := l.index(id)
+	if idx < 0 {
+		return fmt.Errorf("could not find item with Id=%d in list", id)
+	}
+	(*l)[idx].NotifiedAt = now
+	return nil
+}
@@ -0,0 +1,186 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// Built-in layouts accepted by RenderOptions.Layout
+const (
+	LayoutDefault = "default"
+	LayoutTable   = "table"
+	LayoutCompact = "compact"
+	LayoutJSON    = "json"
+)
+
+// ANSI escape codes used to color items
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// RenderOptions type controls how a list is rendered
+//
+// # Attributes
+//
+// - Layout (string): one of the Layout constants, empty means LayoutDefault
+//
+// - Format (string): text/template executed once per item, overrides Layout
+//
+// - Color (bool): whether to color done, overdue and priority items
+type RenderOptions struct {
+	Layout string
+	Format string
+	Color  bool
+}
+
+// Overdue reports whether the item has a deadline in the past and is not done
+func (i item) Overdue() bool {
+	return !i.Done && !i.Due.IsZero() && i.Due.Before(time.Now())
+}
+
+// color returns the ANSI color the item should be printed in, if any
+//
+// Done wins over overdue, which wins over priority
+func (i item) color() string {
+	switch {
+	case i.Done:
+		return colorGreen
+	case i.Overdue():
+		return colorRed
+	case i.Priority > 0:
+		return colorYellow
+	}
+	return ""
+}
+
+// ColorEnabled reports whether output written to f should be colored, which
+// is only the case for terminals and when NO_COLOR is not set
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Render Description:
+//
+// - Writes the list to w using the layout or template given in opts
+//
+// Inputs:
+//
+// - w (io.Writer): destination of the rendered list
+//
+// - opts (RenderOptions): layout, template and color settings
+//
+// Outputs:
+//
+// - error (err|nil): error if the layout is unknown, the template is
+// invalid or writing to w fails
+func (l *List) Render(w io.Writer, opts RenderOptions) error {
+	ls := *l
+	if opts.Format == "" && opts.Layout == LayoutJSON {
+		js, err := json.MarshalIndent(ls, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", js)
+		return err
+	}
+
+	header, lines, err := l.lines(opts)
+	if err != nil {
+		return err
+	}
+	var out strings.Builder
+	out.WriteString(header)
+	for idx, line := range lines {
+		if c := ls[idx].color(); opts.Color && c != "" {
+			line = c + line + colorReset
+		}
+		out.WriteString(line + "\n")
+	}
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// lines renders the header and one uncolored line per item, so color can be
+// applied afterwards without breaking the alignment of the table layout
+func (l *List) lines(opts RenderOptions) (string, []string, error) {
+	ls := *l
+	lines := make([]string, 0, len(ls))
+
+	if opts.Format != "" {
+		tmpl, err := template.New("item").Parse(opts.Format)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, i := range ls {
+			var b bytes.Buffer
+			if err := tmpl.Execute(&b, i); err != nil {
+				return "", nil, err
+			}
+			lines = append(lines, strings.TrimSuffix(b.String(), "\n"))
+		}
+		return "", lines, nil
+	}
+
+	switch opts.Layout {
+	case "", LayoutDefault:
+		for _, i := range ls {
+			lines = append(lines, fmt.Sprintf("\tTask ID: %d, Task Name: %s, Done: %t", i.Id, i.Task, i.Done))
+		}
+		return "ToDo list:\n", lines, nil
+	case LayoutCompact:
+		for _, i := range ls {
+			mark := " "
+			if i.Done {
+				mark = "x"
+			}
+			line := fmt.Sprintf("[%s] %d: %s", mark, i.Id, i.Task)
+			if !i.Due.IsZero() {
+				line += fmt.Sprintf(" (due %s)", i.Due.Format("2006-01-02 15:04"))
+			}
+			lines = append(lines, line)
+		}
+		return "", lines, nil
+	case LayoutTable:
+		var b bytes.Buffer
+		tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tDONE\tPRIORITY\tDUE\tTASK")
+		for _, i := range ls {
+			due := "-"
+			if !i.Due.IsZero() {
+				due = i.Due.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(tw, "%d\t%t\t%d\t%s\t%s\n", i.Id, i.Done, i.Priority, due, i.Task)
+		}
+		if err := tw.Flush(); err != nil {
+			return "", nil, err
+		}
+		rows := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		return rows[0] + "\n", rows[1:], nil
+	}
+	return "", nil, fmt.Errorf("unknown layout %q", opts.Layout)
+}
+
+// String renders the list with the default layout and no color,
+// so both List and *List satisfy fmt.Stringer
+func (l List) String() string {
+	var b strings.Builder
+	l.Render(&b, RenderOptions{})
+	return b.String()
+}
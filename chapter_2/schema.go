@@ -0,0 +1,164 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SchemaVersion is the version of the JSON format written by Save
+//
+// # History
+//
+// - 0: bare JSON array of items, or null once every item was deleted
+//
+// - 1: {"version": N, "items": [...]} envelope around the items
+//
+// - 2: items gained the Priority and Due fields
+//
+// - 3: items gained the NotifiedAt field
+//
+// - 4: items gained the Notes and Tags fields
+const SchemaVersion = 4
+
+var (
+	ErrUnsupportedVersion = errors.New("error: Unsupported todo file version")
+	ErrInvalidFormat      = errors.New("error: Invalid todo file format")
+)
+
+// envelope type is the versioned document written to disk
+//
+// The version is stored next to the items so that future changes to
+// the item type can be detected and migrated when the file is read
+type envelope struct {
+	Version int  `json:"version"`
+	Items   List `json:"items"`
+}
+
+// migration type upgrades a raw JSON document by exactly one version
+type migration func(data []byte) ([]byte, error)
+
+// migrations holds the upgrade chain, migrations[n] turns a version n
+// document into a version n+1 document
+//
+// When SchemaVersion is bumped, a migration must be appended here
+var migrations = []migration{
+	migrateV0ToV1,
+	migrateV1ToV2,
+	migrateV2ToV3,
+	migrateV3ToV4,
+}
+
+// schemaVersion Description:
+//
+// - Detects the schema version of a raw JSON document
+//
+// Inputs:
+//
+// - data ([]byte): contents of a todo file
+//
+// Outputs:
+//
+// - int: detected schema version
+//
+// - error (err|nil): ErrInvalidFormat if the document is not recognized
+func schemaVersion(data []byte) (int, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w: empty document", ErrInvalidFormat)
+	}
+	// Version 0 files were a bare array of items, saved as null when
+	// the last item was deleted
+	if data[0] == '[' || bytes.Equal(data, []byte("null")) {
+		return 0, nil
+	}
+	header := struct {
+		Version *int `json:"version"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidFormat, err)
+	}
+	if header.Version == nil {
+		return 0, fmt.Errorf("%w: missing version", ErrInvalidFormat)
+	}
+	return *header.Version, nil
+}
+
+// migrate Description:
+//
+// - Upgrades a raw JSON document to the current SchemaVersion by running
+// every migration between its version and the current one
+//
+// Inputs:
+//
+// - data ([]byte): contents of a todo file
+//
+// Outputs:
+//
+// - []byte: document in the current schema version
+//
+// - error (err|nil): ErrUnsupportedVersion if the document was written by
+// a newer version of the tool, else any error from the migrations
+func migrate(data []byte) ([]byte, error) {
+	version, err := schemaVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	if version < 0 || version > SchemaVersion {
+		return nil, fmt.Errorf("%w: file has version %d, this tool supports up to version %d",
+			ErrUnsupportedVersion, version, SchemaVersion)
+	}
+	for ; version < SchemaVersion; version++ {
+		if data, err = migrations[version](data); err != nil {
+			return nil, fmt.Errorf("migrating from version %d: %w", version, err)
+		}
+	}
+	return data, nil
+}
+
+// migrateV0ToV1 wraps a bare array of items in a version 1 envelope, a
+// null document becomes an empty list
+func migrateV0ToV1(data []byte) ([]byte, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFormat, err)
+	}
+	if items == nil {
+		items = []json.RawMessage{}
+	}
+	return json.Marshal(struct {
+		Version int               `json:"version"`
+		Items   []json.RawMessage `json:"items"`
+	}{1, items})
+}
+
+// migrateV1ToV2 only bumps the version, the zero values of the new
+// Priority and Due fields already mean no priority and no deadline
+func migrateV1ToV2(data []byte) ([]byte, error) {
+	return setVersion(data, 2)
+}
+
+// migrateV2ToV3 only bumps the version, the zero value of the new
+// NotifiedAt field means no notification was sent yet
+func migrateV2ToV3(data []byte) ([]byte, error) {
+	return setVersion(data, 3)
+}
+
+// migrateV3ToV4 only bumps the version, the zero values of the new
+// Notes and Tags fields mean no notes and no tags
+func migrateV3ToV4(data []byte) ([]byte, error) {
+	return setVersion(data, 4)
+}
+
+// setVersion rewrites the version of an envelope, for migrations that
+// only add fields whose zero values are already correct
+func setVersion(data []byte, version int) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFormat, err)
+	}
+	doc["version"] = json.RawMessage(strconv.Itoa(version))
+	return json.Marshal(doc)
+}
@@ -0,0 +1,140 @@
+package todo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Fields reported in Match.Field
+const (
+	FieldTask  = "task"
+	FieldNotes = "notes"
+	FieldTags  = "tags"
+)
+
+// ANSI escape codes used to highlight matches
+const (
+	highlightStart = "\033[1;31m"
+	highlightEnd   = "\033[0m"
+)
+
+// SearchOptions type controls how a search pattern is interpreted
+//
+// # Attributes
+//
+// - Regex (bool): treat the pattern as a regular expression instead of
+// a plain substring
+//
+// - IgnoreCase (bool): match regardless of letter case
+type SearchOptions struct {
+	Regex      bool
+	IgnoreCase bool
+}
+
+// Match type describes where a pattern matched inside one field of an item
+//
+// # Attributes
+//
+// - Field (string): one of the Field constants
+//
+// - Text (string): full text of the field, or of the single tag that matched
+//
+// - Positions ([][]int): start and end byte offsets of each match in Text
+type Match struct {
+	Field     string
+	Text      string
+	Positions [][]int
+}
+
+// SearchResult type holds every match found in one item
+//
+// # Attributes
+//
+// - Id (int): id of the matching item, to look it up in the list
+//
+// - Matches ([]Match): where the pattern matched, one Match per field or tag
+type SearchResult struct {
+	Id      int
+	Matches []Match
+}
+
+// Search Description:
+//
+// - Looks for the pattern in the task name, notes and tags of every item
+//
+// Inputs:
+//
+// - pattern (string): substring or regular expression to look for
+//
+// - opts (SearchOptions): how to interpret the pattern
+//
+// Outputs:
+//
+// - []SearchResult: items with at least one match, in list order
+//
+// - error (err|nil): error if the pattern is empty or not a valid regex
+func (l *List) Search(pattern string, opts SearchOptions) ([]SearchResult, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("error: Search pattern cannot be blank")
+	}
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, i := range *l {
+		var matches []Match
+		if m, ok := matchField(re, FieldTask, i.Task); ok {
+			matches = append(matches, m)
+		}
+		if m, ok := matchField(re, FieldNotes, i.Notes); ok {
+			matches = append(matches, m)
+		}
+		for _, tag := range i.Tags {
+			if m, ok := matchField(re, FieldTags, tag); ok {
+				matches = append(matches, m)
+			}
+		}
+		if len(matches) > 0 {
+			results = append(results, SearchResult{Id: i.Id, Matches: matches})
+		}
+	}
+	return results, nil
+}
+
+// matchField returns the non-empty matches of re in text, if there are any
+func matchField(re *regexp.Regexp, field, text string) (Match, bool) {
+	var positions [][]int
+	for _, p := range re.FindAllStringIndex(text, -1) {
+		// Patterns such as "a*" also match the empty string everywhere
+		if p[1] > p[0] {
+			positions = append(positions, p)
+		}
+	}
+	if len(positions) == 0 {
+		return Match{}, false
+	}
+	return Match{Field: field, Text: text, Positions: positions}, true
+}
+
+// Highlight returns the text of the match with every matched range
+// wrapped in ANSI bold red
+func (m Match) Highlight() string {
+	var b strings.Builder
+	last := 0
+	for _, p := range m.Positions {
+		b.WriteString(m.Text[last:p[0]])
+		b.WriteString(highlightStart + m.Text[p[0]:p[1]] + highlightEnd)
+		last = p[1]
+	}
+	b.WriteString(m.Text[last:])
+	return b.String()
+}
@@ -22,6 +22,17 @@ import (
 //
 // - CompletedAt (time.Time): time at which the task was completed
 //
+// - Priority (int): importance of the task, 0 means no priority
+//
+// - Due (time.Time): deadline of the task, zero means no deadline
+//
+// - NotifiedAt (time.Time): time at which the overdue notification was
+// sent, zero means no notification was sent yet
+//
+// - Notes (string): free-form notes about the task
+//
+// - Tags ([]string): labels used to group and search tasks
+//
 // This is only used internally in this file, so its name is
 // defined starting with a lowercase character
 type item struct {
@@ -30,6 +41,11 @@ type item struct {
 	Done        bool
 	CreatedAt   time.Time
 	CompletedAt time.Time
+	Priority    int
+	Due         time.Time
+	NotifiedAt  time.Time
+	Notes       string
+	Tags        []string
 }
 
 // List type represents a list of ToDo items
@@ -50,13 +66,36 @@ type List []item
 //
 // - error (err|nil): err if task not found, nil else
 func (l *List) CheckItemId(id int) error {
+	if l.index(id) < 0 {
+		return fmt.Errorf("could not find item with Id=%d in list", id)
+	}
+	return nil
+}
+
+// index returns the position in the list of the item with the given id,
+// or -1 if no such item exists
+//
+// Ids and positions stop lining up as soon as items are deleted or archived,
+// so all lookups by id should go through here
+func (l *List) index(id int) int {
 	ls := *l
-	for idx := 0; idx < len(*l); idx++ {
+	for idx := 0; idx < len(ls); idx++ {
 		if ls[idx].Id == id {
-			return nil
+			return idx
+		}
+	}
+	return -1
+}
+
+// nextId returns an id that is not used by any item in the list
+func (l *List) nextId() int {
+	next := 0
+	for _, i := range *l {
+		if i.Id >= next {
+			next = i.Id + 1
 		}
 	}
-	return fmt.Errorf("could not find item with Id=%d in list", id)
+	return next
 }
 
 // Add Description:
@@ -72,7 +111,7 @@ func (l *List) CheckItemId(id int) error {
 // - None
 func (l *List) Add(task string) item {
 	new_task := item{
-		Id:          len(*l),
+		Id:          l.nextId(),
 		Task:        task,
 		Done:        false,
 		CreatedAt:   time.Now(),
@@ -97,11 +136,12 @@ func (l *List) Add(task string) item {
 // - error (fmt.Errorf | nil): error if ID is OOB, else nil
 func (l *List) Complete(id int) error {
 	ls := *l
-	if ls.CheckItemId(id) != nil {
+	idx := ls.index(id)
+	if idx < 0 {
 		return fmt.Errorf("could not find item with Id=%d in list", id)
 	}
-	ls[id].Done = true
-	ls[id].CompletedAt = time.Now()
+	ls[idx].Done = true
+	ls[idx].CompletedAt = time.Now()
 
 	return nil
 }
@@ -134,9 +174,177 @@ func (l *List) Delete(id int) error {
 	return nil
 }
 
+// SetPriority Description:
+//
+// - Sets the priority of a todo item, higher values are more important
+//
+// Inputs:
+//
+// - id (int): ID of task to be updated
+//
+// - priority (int): new priority, 0 clears it
+//
+// Outputs:
+//
+// - error (fmt.Errorf | nil): error if ID is not found, else nil
+func (l *List) SetPriority(id int, priority int) error {
+	idx := l.index(id)
+	if idx < 0 {
+		return fmt.Errorf("could not find item with Id=%d in list", id)
+	}
+	(*l)[idx].Priority = priority
+	return nil
+}
+
+// SetDue Description:
+//
+// - Sets the deadline of a todo item
+//
+// - Changing the deadline allows a new overdue notification to be sent
+//
+// Inputs:
+//
+// - id (int): ID of task to be updated
+//
+// - due (time.Time): new deadline, the zero time clears it
+//
+// Outputs:
+//
+// - error (fmt.Errorf | nil): error if ID is not found, else nil
+func (l *List) SetDue(id int, due time.Time) error {
+	idx := l.index(id)
+	if idx < 0 {
+		return fmt.Errorf("could not find item with Id=%d in list", id)
+	}
+	(*l)[idx].Due = due
+	(*l)[idx].NotifiedAt = time.Time{}
+	return nil
+}
+
+// SetNotes Description:
+//
+// - Replaces the notes of a todo item
+//
+// Inputs:
+//
+// - id (int): ID of task to be updated
+//
+// - notes (string): new notes, empty clears them
+//
+// Outputs:
+//
+// - error (fmt.Errorf | nil): error if ID is not found, else nil
+func (l *List) SetNotes(id int, notes string) error {
+	idx := l.index(id)
+	if idx < 0 {
+		return fmt.Errorf("could not find item with Id=%d in list", id)
+	}
+	(*l)[idx].Notes = notes
+	return nil
+}
+
+// SetTags Description:
+//
+// - Replaces the tags of a todo item
+//
+// Inputs:
+//
+// - id (int): ID of task to be updated
+//
+// - tags (...string): new tags, none clears them
+//
+// Outputs:
+//
+// - error (fmt.Errorf | nil): error if ID is not found, else nil
+func (l *List) SetTags(id int, tags ...string) error {
+	idx := l.index(id)
+	if idx < 0 {
+		return fmt.Errorf("could not find item with Id=%d in list", id)
+	}
+	(*l)[idx].Tags = tags
+	return nil
+}
+
+// Archive Description:
+//
+// - Moves every completed item that was completed more than age ago
+// out of the list and appends it to the archive list a
+//
+// - An item already in the archive, left by a run that saved the archive
+// but not the list, is skipped so its id isn't archived twice. A
+// different item reusing an archived id is given a new id in the archive
+//
+// Inputs:
+//
+// - a (*List): archive list that old completed items are moved to
+//
+// - age (time.Duration): how long ago an item must have been completed
+// before it is archived
+//
+// Outputs:
+//
+// - int: number of items that were moved to the archive
+func (l *List) Archive(a *List, age time.Duration) int {
+	cutoff := time.Now().Add(-age)
+	var kept []item
+	moved := 0
+	for _, i := range *l {
+		if i.Done && !i.CompletedAt.After(cutoff) {
+			if idx := a.index(i.Id); idx >= 0 {
+				archived := (*a)[idx]
+				if archived.Task == i.Task && archived.CreatedAt.Equal(i.CreatedAt) {
+					continue
+				}
+				i.Id = a.nextId()
+			}
+			*a = append(*a, i)
+			moved++
+			continue
+		}
+		kept = append(kept, i)
+	}
+	*l = kept
+	return moved
+}
+
+// Restore Description:
+//
+// - Moves an item from the archive list a back into the list
+//
+// - If the id of the archived item has been reused in the meantime,
+// the restored item is given a new id
+//
+// Inputs:
+//
+// - a (*List): archive list the item is taken from
+//
+// - id (int): ID of the archived task to be restored
+//
+// Outputs:
+//
+// - item: the restored item, with its id in the list
+//
+// - error (fmt.Errorf | nil): error if the id is not in the archive, else nil
+func (l *List) Restore(a *List, id int) (item, error) {
+	idx := a.index(id)
+	if idx < 0 {
+		return item{}, fmt.Errorf("could not find item with Id=%d in archive", id)
+	}
+	restored := (*a)[idx]
+	if err := a.Delete(id); err != nil {
+		return item{}, err
+	}
+	if l.CheckItemId(restored.Id) == nil {
+		restored.Id = l.nextId()
+	}
+	*l = append(*l, restored)
+	return restored, nil
+}
+
 // Save Description
 //
-// - Uses the json.Marshal function to encode l into JSON
+// - Uses the json.Marshal function to encode l into JSON, wrapped in an
+// envelope recording the SchemaVersion
 //
 // - If json encoding is successful, writes to file specified in args
 //
@@ -148,7 +356,7 @@ func (l *List) Delete(id int) error {
 //
 // - error (err|nil): Throws error if there is a problem marshalling item
 func (l *List) Save(filename string) error {
-	js, err := json.Marshal(l)
+	js, err := json.Marshal(envelope{Version: SchemaVersion, Items: *l})
 	if err != nil {
 		return err
 	}
@@ -159,6 +367,9 @@ func (l *List) Save(filename string) error {
 //
 // - Opens the provided file name, decodes the JSON data and turns into a list
 //
+// - Files written in an older schema version are migrated, files written
+// in a newer version are refused
+//
 // - Performs the inverse function of the Save method
 //
 // Inputs:
@@ -167,7 +378,8 @@ func (l *List) Save(filename string) error {
 //
 // # Outputs
 //
-// - result (err|nil|object): Returns error if file is not found, else returns object
+// - result (err|nil|object): Returns error if file can't be read or has an
+// unsupported version, else returns object
 func (l *List) Get(filename string) error {
 	// Try opening the file for reading
 	file, err := os.ReadFile(filename)
@@ -177,20 +389,27 @@ func (l *List) Get(filename string) error {
 			// If the file doesn't exist, just return a blank object (nil)
 			return nil
 		}
+		return err
 	}
 	// If the file is found but has nothing in it, just return nil
 	if len(file) == 0 {
 		return nil
 	}
-	// If the file is found and is not empty, unmarshal it
-	return json.Unmarshal(file, l)
+	// Bring the file up to the current version before decoding it
+	file, err = migrate(file)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	var e envelope
+	if err := json.Unmarshal(file, &e); err != nil {
+		return err
+	}
+	*l = e.Items
+	return nil
 }
 
-// Print Description outputs list in human-readable form
+// Print Description outputs list in human-readable form to stdout,
+// colored when stdout is a terminal
 func (l *List) Print() {
-	ls := *l
-	fmt.Println("ToDo list:")
-	for idx := 0; idx < len(ls); idx++ {
-		fmt.Printf("\tTask ID: %d, Task Name: %s, Done: %t\n", ls[idx].Id, ls[idx].Task, ls[idx].Done)
-	}
+	l.Render(os.Stdout, RenderOptions{Color: ColorEnabled(os.Stdout)})
 }
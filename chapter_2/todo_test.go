@@ -1,9 +1,15 @@
 package todo_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"time"
 	"todo"
 )
 
@@ -145,6 +151,342 @@ func TestSaveGet(t *testing.T) {
 	}
 }
 
+// TestArchiveRestore checks that completed items move to the archive and back
+func TestArchiveRestore(t *testing.T) {
+	l := todo.List{}
+	a := todo.List{}
+	open := l.Add("Test 5: Open Task")
+	done := l.Add("Test 5: Done Task")
+	l.Complete(done.Id)
+	// Nothing was completed long enough ago yet
+	if n := l.Archive(&a, time.Hour); n != 0 {
+		t.Errorf("Expected 0 items to be archived, got %d instead", n)
+	}
+	if n := l.Archive(&a, 0); n != 1 {
+		t.Errorf("Expected 1 item to be archived, got %d instead", n)
+	}
+	if l.CheckItemId(done.Id) == nil || a.CheckItemId(done.Id) != nil {
+		t.Fatalf("Expected done item to be moved to the archive")
+	}
+	if l.CheckItemId(open.Id) != nil {
+		t.Errorf("Expected open item to stay in the list")
+	}
+	// Reuse the archived id so the restored item has to be renumbered
+	reused := l.Add("Test 5: New Task")
+	if reused.Id != done.Id {
+		t.Fatalf("Expected new item to reuse Id=%d, got %d instead", done.Id, reused.Id)
+	}
+	restored, err := l.Restore(&a, done.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 0 {
+		t.Errorf("Expected archive to be empty, got %d items", len(a))
+	}
+	if restored.Id == reused.Id || l.CheckItemId(restored.Id) != nil {
+		t.Errorf("Expected restored item to get a fresh id, got %d", restored.Id)
+	}
+	if _, err := l.Restore(&a, done.Id); err == nil {
+		t.Errorf("Expected error restoring an item that is not archived")
+	}
+}
+
+// TestArchiveTwice checks that archive ids stay unique when an item is
+// archived again or its id is reused
+func TestArchiveTwice(t *testing.T) {
+	l := todo.List{}
+	a := todo.List{}
+	done := l.Add("Test 7: Done Task")
+	l.Complete(done.Id)
+	// A run that saved the archive but failed to save the list
+	stale := append(todo.List{}, l...)
+	if n := l.Archive(&a, 0); n != 1 {
+		t.Fatalf("Expected 1 item to be archived, got %d instead", n)
+	}
+	if n := stale.Archive(&a, 0); n != 0 || len(a) != 1 || len(stale) != 0 {
+		t.Errorf("Expected the archived item to be skipped, got %d moved and %d archived", n, len(a))
+	}
+	// A new item reusing the archived id
+	reused := l.Add("Test 7: New Task")
+	l.Complete(reused.Id)
+	if reused.Id != done.Id {
+		t.Fatalf("Expected new item to reuse Id=%d, got %d instead", done.Id, reused.Id)
+	}
+	if n := l.Archive(&a, 0); n != 1 || len(a) != 2 {
+		t.Fatalf("Expected the new item to be archived, got %d moved and %d archived", n, len(a))
+	}
+	if a[0].Id == a[1].Id {
+		t.Errorf("Expected unique archive ids, got %d twice", a[0].Id)
+	}
+}
+
+// TestCompleteAfterDelete checks that ids keep working once they stop matching positions
+func TestCompleteAfterDelete(t *testing.T) {
+	l := todo.List{}
+	first := l.Add("Test 6: First Task")
+	second := l.Add("Test 6: Second Task")
+	l.Delete(first.Id)
+	if err := l.Complete(second.Id); err != nil {
+		t.Fatal(err)
+	}
+	if !l[0].Done {
+		t.Errorf("Expected task %d to be done", second.Id)
+	}
+}
+
+// TestGetGolden checks that every historical file format can still be read
+func TestGetGolden(t *testing.T) {
+	testCases := []struct {
+		name string
+		file string
+	}{
+		{"V0BareArray", "testdata/v0.json"},
+		{"V1Envelope", "testdata/v1.json"},
+		{"V2PriorityDue", "testdata/v2.json"},
+		{"V3NotifiedAt", "testdata/v3.json"},
+		{"V4NotesTags", "testdata/v4.json"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := todo.List{}
+			if err := l.Get(tc.file); err != nil {
+				t.Fatal(err)
+			}
+			if len(l) != 2 {
+				t.Fatalf("Expected 2 items, got %d instead", len(l))
+			}
+			if l[0].Task != "Write the report" || !l[0].Done {
+				t.Errorf("Unexpected first item: %+v", l[0])
+			}
+			if l[1].Task != "Review the report" || l[1].Done {
+				t.Errorf("Unexpected second item: %+v", l[1])
+			}
+		})
+	}
+}
+
+// TestGetGoldenNull checks that a version 0 file saved after deleting
+// every item reads as an empty list
+func TestGetGoldenNull(t *testing.T) {
+	l := todo.List{}
+	l.Add("Not from the file")
+	if err := l.Get("testdata/v0null.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 0 {
+		t.Errorf("Expected an empty list, got %d items instead", len(l))
+	}
+}
+
+// TestSaveGolden checks that Save writes the current format byte for byte
+func TestSaveGolden(t *testing.T) {
+	golden := "testdata/v4.json"
+	l := todo.List{}
+	// Read the old format so the test also covers writing a migrated list
+	if err := l.Get("testdata/v0.json"); err != nil {
+		t.Fatal(err)
+	}
+	tempFile, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+	defer os.Remove(tempFile.Name())
+	if err := l.Save(tempFile.Name()); err != nil {
+		t.Fatal(err)
+	}
+	result, err := os.ReadFile(tempFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, result) {
+		t.Errorf("Result does not match golden file %s:\n%s\n", golden, result)
+	}
+}
+
+// TestGetNewerVersion checks that files from a newer tool are refused
+func TestGetNewerVersion(t *testing.T) {
+	l := todo.List{}
+	err := l.Get("testdata/v99.json")
+	if !errors.Is(err, todo.ErrUnsupportedVersion) {
+		t.Errorf("Expected error %q, got %q instead", todo.ErrUnsupportedVersion, err)
+	}
+}
+
+// TestRender checks the built-in layouts, templates and coloring
+func TestRender(t *testing.T) {
+	l := todo.List{}
+	l.Add("Done Task")
+	l.Add("Late Task")
+	l.Add("Important Task")
+	l.Complete(0)
+	l.SetDue(1, time.Now().Add(-time.Hour))
+	l.SetPriority(2, 3)
+
+	testCases := []struct {
+		name     string
+		opts     todo.RenderOptions
+		expected string
+	}{
+		{"Default", todo.RenderOptions{},
+			"ToDo list:\n\tTask ID: 0, Task Name: Done Task, Done: true\n" +
+				"\tTask ID: 1, Task Name: Late Task, Done: false\n" +
+				"\tTask ID: 2, Task Name: Important Task, Done: false\n"},
+		{"Template", todo.RenderOptions{Format: "{{.Id}}|{{.Task}}|{{.Overdue}}"},
+			"0|Done Task|false\n1|Late Task|true\n2|Important Task|false\n"},
+		{"Color", todo.RenderOptions{Format: "{{.Task}}", Color: true},
+			"\033[32mDone Task\033[0m\n\033[31mLate Task\033[0m\n\033[33mImportant Task\033[0m\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := l.Render(&out, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tc.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q\n", tc.expected, out.String())
+			}
+		})
+	}
+
+	t.Run("Table", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := l.Render(&out, todo.RenderOptions{Layout: todo.LayoutTable}); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(lines) != 4 || !strings.HasPrefix(lines[0], "ID  DONE") {
+			t.Errorf("Unexpected table:\n%s", out.String())
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := l.Render(&out, todo.RenderOptions{Layout: todo.LayoutJSON}); err != nil {
+			t.Fatal(err)
+		}
+		var decoded todo.List
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded) != 3 || decoded[2].Priority != 3 {
+			t.Errorf("Unexpected JSON output:\n%s", out.String())
+		}
+	})
+
+	t.Run("UnknownLayout", func(t *testing.T) {
+		if err := l.Render(io.Discard, todo.RenderOptions{Layout: "fancy"}); err == nil {
+			t.Errorf("Expected error for unknown layout")
+		}
+	})
+}
+
+// TestDue checks the due listing, summary and notification tracking
+func TestDue(t *testing.T) {
+	now := time.Date(2022, 11, 7, 12, 0, 0, 0, time.UTC)
+	l := todo.List{}
+	late := l.Add("Late Task")
+	soon := l.Add("Soon Task")
+	later := l.Add("Later Task")
+	l.Add("No Deadline Task")
+	done := l.Add("Done Late Task")
+	l.SetDue(late.Id, now.Add(-time.Hour))
+	l.SetDue(soon.Id, now.Add(time.Hour))
+	l.SetDue(later.Id, now.Add(48*time.Hour))
+	l.SetDue(done.Id, now.Add(-time.Hour))
+	l.Complete(done.Id)
+
+	due := l.DueWithin(24*time.Hour, now)
+	if len(due) != 2 || due[0].Id != late.Id || due[1].Id != soon.Id {
+		t.Errorf("Expected tasks %d and %d to be due, got %+v", late.Id, soon.Id, due)
+	}
+	if s := l.DueSummary(24*time.Hour, now); s != "1 overdue, 1 due" {
+		t.Errorf("Expected summary %q, got %q instead", "1 overdue, 1 due", s)
+	}
+	if s := l.DueSummary(30*time.Minute, now.Add(-2*time.Hour)); s != "" {
+		t.Errorf("Expected empty summary, got %q instead", s)
+	}
+
+	overdue := l.NewlyOverdue(now)
+	if len(overdue) != 1 || overdue[0].Id != late.Id {
+		t.Fatalf("Expected task %d to be newly overdue, got %+v", late.Id, overdue)
+	}
+	if err := l.MarkNotified(late.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if overdue := l.NewlyOverdue(now); len(overdue) != 0 {
+		t.Errorf("Expected no newly overdue tasks after notifying, got %+v", overdue)
+	}
+	// Moving the deadline allows a new notification
+	l.SetDue(late.Id, now.Add(-time.Minute))
+	if overdue := l.NewlyOverdue(now); len(overdue) != 1 {
+		t.Errorf("Expected task %d to be newly overdue again", late.Id)
+	}
+}
+
+// TestSearch checks the substring, case-insensitive and regex search modes
+func TestSearch(t *testing.T) {
+	l := todo.List{}
+	milk := l.Add("Buy milk")
+	report := l.Add("Write Report")
+	l.SetNotes(report.Id, "the report needs milk figures")
+	l.SetTags(milk.Id, "shopping", "home")
+
+	testCases := []struct {
+		name     string
+		pattern  string
+		opts     todo.SearchOptions
+		expected []int
+	}{
+		{"Substring", "milk", todo.SearchOptions{}, []int{milk.Id, report.Id}},
+		{"CaseSensitive", "report", todo.SearchOptions{}, []int{report.Id}},
+		{"IgnoreCase", "REPORT", todo.SearchOptions{IgnoreCase: true}, []int{report.Id}},
+		{"Tag", "shop", todo.SearchOptions{}, []int{milk.Id}},
+		{"Regex", "^Buy|^Write", todo.SearchOptions{Regex: true}, []int{milk.Id, report.Id}},
+		{"RegexMetaAsSubstring", "^Buy", todo.SearchOptions{}, nil},
+		{"EmptyMatches", "x*", todo.SearchOptions{Regex: true}, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := l.Search(tc.pattern, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, r := range results {
+				ids = append(ids, r.Id)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tc.expected) {
+				t.Errorf("Expected ids %v, got %v instead", tc.expected, ids)
+			}
+		})
+	}
+
+	t.Run("Positions", func(t *testing.T) {
+		results, err := l.Search("r", todo.SearchOptions{IgnoreCase: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := results[0].Matches[0]
+		if m.Field != todo.FieldTask || fmt.Sprint(m.Positions) != "[[1 2] [6 7] [10 11]]" {
+			t.Errorf("Unexpected match %+v", m)
+		}
+		expected := "W\033[1;31mr\033[0mite \033[1;31mR\033[0mepo\033[1;31mr\033[0mt"
+		if m.Highlight() != expected {
+			t.Errorf("Expected %q, got %q instead", expected, m.Highlight())
+		}
+	})
+
+	t.Run("InvalidRegex", func(t *testing.T) {
+		if _, err := l.Search("(", todo.SearchOptions{Regex: true}); err == nil {
+			t.Errorf("Expected error for invalid regex")
+		}
+	})
+}
+
 // Examples
 
 func ExampleList_Add() {
@@ -172,3 +514,12 @@ func ExampleList_Delete() {
 	fmt.Println(preDeletionLength, postDeletionLength)
 	// Output: 1 0
 }
+
+func ExampleList_String() {
+	exampleList := todo.List{}
+	exampleList.Add("Example Task Name")
+	fmt.Print(exampleList)
+	// Output:
+	// ToDo list:
+	//	Task ID: 0, Task Name: Example Task Name, Done: false
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// manifestName is the file in the output directory listing the pages of the
+// last build, so adding or removing a page rebuilds every page's navigation
+//
+// Its first line records the settings of that build, so changing the
+// template or a rendering option rebuilds every page too
+const manifestName = ".mdp-build"
+
+// settingsPrefix starts the first line of the manifest
+const settingsPrefix = "settings "
+
+// mdLink matches links and images pointing at relative markdown files,
+// anything with a scheme such as https: is left alone
+var mdLink = regexp.MustCompile(`(href|src)="([^":#?]+)\.md(#[^"]*)?"`)
+
+// page type describes one markdown file of the site
+type page struct {
+	// Path relative to the source directory, with forward slashes
+	src string
+	// Path of the generated HTML relative to the output directory
+	out string
+	// Title shown in the navigation
+	title string
+}
+
+// buildResult type counts what a build did, for reporting and testing
+type buildResult struct {
+	built   int
+	skipped int
+	copied  int
+	removed int
+}
+
+// buildCmd parses the build subcommand flags and builds the site
+func buildCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	src := fs.String("src", "", "Directory of markdown files to build")
+	dst := fs.String("out", "site", "Directory the site is written to")
+	force := fs.Bool("force", false, "Rebuild every page even if it hasn't changed")
+	renderConfig := addRenderFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *src == "" {
+		fs.Usage()
+		return fmt.Errorf("build: -src is required")
+	}
+	r, err := build(*src, *dst, *force, renderConfig())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Built %d pages, skipped %d unchanged, removed %d, copied %d assets into %s\n",
+		r.built, r.skipped, r.removed, r.copied, *dst)
+	return nil
+}
+
+// build renders every markdown file under src into dst, copying the
+// other files as assets
+//
+// Pages and assets are only written when the source is newer than the
+// output, unless force is set, or the set of pages or the settings changed
+// since the last build, in which case every page is out of date. Pages
+// removed since the last build have their output deleted
+func build(src, dst string, force bool, conf config) (buildResult, error) {
+	var r buildResult
+	pages, assets, err := collectSite(src, dst, conf)
+	if err != nil {
+		return r, err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return r, err
+	}
+
+	// Compare the settings and page list with the previous build
+	settings, err := buildSettings(conf)
+	if err != nil {
+		return r, err
+	}
+	var list strings.Builder
+	list.WriteString(settingsPrefix + settings + "\n")
+	current := map[string]bool{}
+	for _, p := range pages {
+		list.WriteString(p.src + "\n")
+		current[p.src] = true
+	}
+	manifest := filepath.Join(dst, manifestName)
+	old, err := os.ReadFile(manifest)
+	if err != nil || string(old) != list.String() {
+		force = true
+	}
+	if r.removed, err = removeStale(dst, string(old), current); err != nil {
+		return r, err
+	}
+
+	hasIndex := false
+	for _, p := range pages {
+		if p.out == "index.html" {
+			hasIndex = true
+		}
+		srcPath := filepath.Join(src, filepath.FromSlash(p.src))
+		outPath := filepath.Join(dst, filepath.FromSlash(p.out))
+		if !force && upToDate(srcPath, outPath) {
+			r.skipped++
+			continue
+		}
+		input, err := os.ReadFile(srcPath)
+		if err != nil {
+			return r, err
+		}
+		pageConf := conf
+		pageConf.nav = template.HTML(navHTML(pages, p.out))
+		htmlData, err := parseContent(input, pageConf)
+		if err != nil {
+			return r, fmt.Errorf("%s: %w", p.src, err)
+		}
+		htmlData = rewriteLinks(htmlData)
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			return r, err
+		}
+		if err := saveHTML(outPath, htmlData); err != nil {
+			return r, err
+		}
+		r.built++
+	}
+
+	// Sites without an index.md get a generated one listing every page
+	if !hasIndex && force {
+		index, err := executeTemplate(conf.tFname, content{
+			Title: "Index",
+			Body:  template.HTML("<h1>Index</h1>\n" + navHTML(pages, "index.html")),
+			Meta:  map[string]string{},
+		})
+		if err != nil {
+			return r, err
+		}
+		if err := saveHTML(filepath.Join(dst, "index.html"), index); err != nil {
+			return r, err
+		}
+	}
+
+	for _, a := range assets {
+		srcPath := filepath.Join(src, filepath.FromSlash(a))
+		outPath := filepath.Join(dst, filepath.FromSlash(a))
+		if upToDate(srcPath, outPath) {
+			continue
+		}
+		if err := copyFile(srcPath, outPath); err != nil {
+			return r, err
+		}
+		r.copied++
+	}
+
+	return r, os.WriteFile(manifest, []byte(list.String()), 0644)
+}
+
+// buildSettings returns a hash of everything besides the sources that
+// changes the rendered pages: the options, the template and the allowlist
+func buildSettings(conf config) (string, error) {
+	h := sha256.New()
+	conf.nav = ""
+	conf.errOut = nil
+	fmt.Fprintf(h, "%#v\n", conf)
+	for _, name := range []string{conf.tFname, conf.allowlist} {
+		if name == "" {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// removeStale deletes the output of pages listed in the old manifest that
+// are no longer in the site, returning how many were removed
+func removeStale(dst, oldManifest string, current map[string]bool) (int, error) {
+	removed := 0
+	for _, src := range strings.Split(oldManifest, "\n") {
+		if src == "" || strings.HasPrefix(src, settingsPrefix) || current[src] {
+			continue
+		}
+		// The manifest is only trusted to name pages inside dst
+		out := path.Clean(strings.TrimSuffix(src, ".md") + ".html")
+		if path.IsAbs(out) || out == ".." || strings.HasPrefix(out, "../") {
+			continue
+		}
+		err := os.Remove(filepath.Join(dst, filepath.FromSlash(out)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// collectSite walks src and returns its pages and asset paths in walk
+// order, skipping hidden files and the output directory
+func collectSite(src, dst string, conf config) ([]page, []string, error) {
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pages []page
+	var assets []string
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			// Don't copy the site into itself when it lives inside src
+			if abs, err := filepath.Abs(p); err == nil && abs == absDst {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if filepath.Ext(rel) != ".md" {
+			assets = append(assets, rel)
+			return nil
+		}
+		input, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		pages = append(pages, page{
+			src:   rel,
+			out:   strings.TrimSuffix(rel, ".md") + ".html",
+			title: pageTitle(input, rel, conf),
+		})
+		return nil
+	})
+	return pages, assets, err
+}
+
+// pageTitle returns the title shown in the navigation for a page, taken
+// from the front matter, the first heading or the file name
+func pageTitle(input []byte, rel string, conf config) string {
+	fm, _, doc, _, err := parseMarkdown(input, conf)
+	if err == nil {
+		if title := fm.title(); title != "" {
+			return title
+		}
+		if title := firstHeading(doc); title != "" {
+			return title
+		}
+	}
+	return strings.TrimSuffix(path.Base(rel), ".md")
+}
+
+// navHTML builds the navigation sidebar as nested lists following the
+// directory structure, with links relative to the page at current
+func navHTML(pages []page, current string) string {
+	// Links from pages in subdirectories have to climb back to the root
+	prefix := strings.Repeat("../", strings.Count(current, "/"))
+	var b strings.Builder
+	b.WriteString("<ul>\n")
+	var open []string
+	for _, p := range pages {
+		var dirs []string
+		if dir := path.Dir(p.src); dir != "." {
+			dirs = strings.Split(dir, "/")
+		}
+		// Close the directories this page isn't in
+		common := 0
+		for common < len(open) && common < len(dirs) && open[common] == dirs[common] {
+			common++
+		}
+		for len(open) > common {
+			b.WriteString("</ul>\n</li>\n")
+			open = open[:len(open)-1]
+		}
+		for _, d := range dirs[common:] {
+			fmt.Fprintf(&b, "<li>%s\n<ul>\n", html.EscapeString(d))
+			open = append(open, d)
+		}
+		class := ""
+		if p.out == current {
+			class = ` class="current"`
+		}
+		fmt.Fprintf(&b, "<li%s><a href=\"%s\">%s</a></li>\n", class, html.EscapeString(prefix+p.out), html.EscapeString(p.title))
+	}
+	for range open {
+		b.WriteString("</ul>\n</li>\n")
+	}
+	b.WriteString("</ul>\n")
+	return b.String()
+}
+
+// rewriteLinks points relative links to markdown files at the generated
+// HTML pages, keeping any #anchor
+func rewriteLinks(htmlData []byte) []byte {
+	return mdLink.ReplaceAll(htmlData, []byte(`$1="$2.html$3"`))
+}
+
+// upToDate reports whether out exists and is at least as new as src
+func upToDate(src, out string) bool {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	outInfo, err := os.Stat(out)
+	if err != nil {
+		return false
+	}
+	return !outInfo.ModTime().Before(srcInfo.ModTime())
+}
+
+// copyFile copies an asset, creating its directory if needed
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
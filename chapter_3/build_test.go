@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuild checks a directory is rendered into a site with working links
+func TestBuild(t *testing.T) {
+	dst := t.TempDir()
+	r, err := build("./testdata/site", dst, false, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.built != 2 || r.skipped != 0 || r.copied != 1 {
+		t.Errorf("Expected 2 built, 0 skipped, 1 copied, got %+v", r)
+	}
+
+	readme := readSiteFile(t, dst, "README.html")
+	for _, expected := range []string{
+		`<a href="guides/setup.html#install" rel="nofollow">setup guide</a>`,
+		`<a href="https://example.com/page.md" rel="nofollow">`,
+		`<li class="current"><a href="README.html">Team Docs</a></li>`,
+		`<li>guides`,
+	} {
+		if !strings.Contains(readme, expected) {
+			t.Errorf("Expected %q in README.html:\n%s", expected, readme)
+		}
+	}
+
+	setup := readSiteFile(t, dst, filepath.Join("guides", "setup.html"))
+	for _, expected := range []string{
+		`<title>Setup Guide</title>`,
+		`<img src="../img/logo.png" alt="Logo"/>`,
+		`<a href="../README.html" rel="nofollow">docs home</a>`,
+		`<li><a href="../README.html">Team Docs</a></li>`,
+		`<li class="current"><a href="../guides/setup.html">Setup Guide</a></li>`,
+	} {
+		if !strings.Contains(setup, expected) {
+			t.Errorf("Expected %q in setup.html:\n%s", expected, setup)
+		}
+	}
+
+	index := readSiteFile(t, dst, "index.html")
+	if !strings.Contains(index, `<a href="guides/setup.html">Setup Guide</a>`) {
+		t.Errorf("Expected generated index to list pages:\n%s", index)
+	}
+	if logo := readSiteFile(t, dst, filepath.Join("img", "logo.png")); logo != "not really a png\n" {
+		t.Errorf("Expected asset to be copied, got %q", logo)
+	}
+}
+
+// TestBuildIncremental checks only changed pages are rebuilt
+func TestBuildIncremental(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(src, "site")
+	writeSiteFile(t, src, "a.md", "# A\n")
+	writeSiteFile(t, src, "b.md", "# B\n")
+	if _, err := build(src, dst, false, config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := build(src, dst, false, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.built != 0 || r.skipped != 2 {
+		t.Errorf("Expected every page to be skipped, got %+v", r)
+	}
+
+	// Editing a page only rebuilds that page
+	writeSiteFile(t, src, "a.md", "# A again\n")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(src, "a.md"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = build(src, dst, false, config{}); err != nil {
+		t.Fatal(err)
+	}
+	if r.built != 1 || r.skipped != 1 {
+		t.Errorf("Expected 1 page to be rebuilt, got %+v", r)
+	}
+
+	// Adding a page changes the navigation of every page
+	writeSiteFile(t, src, "c.md", "# C\n")
+	if r, err = build(src, dst, false, config{}); err != nil {
+		t.Fatal(err)
+	}
+	if r.built != 3 || r.skipped != 0 {
+		t.Errorf("Expected every page to be rebuilt, got %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "site")); err == nil {
+		t.Errorf("Expected the output directory not to be copied into itself")
+	}
+
+	// Removing a page deletes its output
+	if err := os.Remove(filepath.Join(src, "c.md")); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = build(src, dst, false, config{}); err != nil {
+		t.Fatal(err)
+	}
+	if r.built != 2 || r.removed != 1 {
+		t.Errorf("Expected 2 pages rebuilt and 1 removed, got %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "c.html")); !os.IsNotExist(err) {
+		t.Errorf("Expected the output of the removed page to be deleted")
+	}
+
+	// Changing the template or an option rebuilds every page
+	tmpl := filepath.Join(t.TempDir(), "page.tmpl")
+	if err := os.WriteFile(tmpl, []byte(defaultTemplate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, conf := range []config{{tFname: tmpl}, {tFname: tmpl, toc: true}} {
+		if r, err = build(src, dst, false, conf); err != nil {
+			t.Fatal(err)
+		}
+		if r.built != 2 || r.skipped != 0 {
+			t.Errorf("Expected every page to be rebuilt for %+v, got %+v", conf, r)
+		}
+	}
+	if err := os.WriteFile(tmpl, []byte(defaultTemplate+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = build(src, dst, false, config{tFname: tmpl, toc: true}); err != nil {
+		t.Fatal(err)
+	}
+	if r.built != 2 || r.skipped != 0 {
+		t.Errorf("Expected every page to be rebuilt for an edited template, got %+v", r)
+	}
+}
+
+// TestBuildNavEscaped checks page paths can't inject markup into the navigation
+func TestBuildNavEscaped(t *testing.T) {
+	nav := navHTML([]page{{src: `a"b.md`, out: `a"b.html`, title: "A"}}, "index.html")
+	if !strings.Contains(nav, `<a href="a&#34;b.html">A</a>`) {
+		t.Errorf("Expected the link to be escaped:\n%s", nav)
+	}
+}
+
+// readSiteFile returns the contents of a file in the built site
+func readSiteFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// writeSiteFile creates a source file for a build
+func writeSiteFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// linkRef type is a link or image found in a markdown file
+type linkRef struct {
+	// Line of the markdown file the link is on
+	line int
+	// Destination as written in the file
+	dest string
+	// Whether the link is an image
+	image bool
+	// Alternative text of an image
+	alt string
+}
+
+// problem type is a broken link reported by check
+type problem struct {
+	file string
+	line int
+	msg  string
+}
+
+// String formats a problem the way compilers do, so editors can jump to it
+func (p problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.file, p.line, p.msg)
+}
+
+// checker type checks links across files, caching the heading IDs of
+// every markdown file it parses
+type checker struct {
+	ids map[string]map[string]bool
+	// Fetch external URLs instead of only listing them
+	fetch  bool
+	client *http.Client
+}
+
+// checkCmd parses the check subcommand flags and checks every markdown
+// file given, directories are searched recursively
+func checkCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fetch := fs.Bool("fetch", false, "Fetch external URLs to check them too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("check: no files or directories given")
+	}
+	files, err := markdownFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	c := &checker{
+		ids:    map[string]map[string]bool{},
+		fetch:  *fetch,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	count := 0
+	for _, f := range files {
+		problems, external, err := c.checkFile(f)
+		if err != nil {
+			return err
+		}
+		for _, e := range external {
+			fmt.Fprintf(out, "%s:%d: external %s\n", f, e.line, e.dest)
+		}
+		for _, p := range problems {
+			fmt.Fprintln(out, p)
+		}
+		count += len(problems)
+	}
+	if count > 0 {
+		return fmt.Errorf("check: found %d problems in %d files", count, len(files))
+	}
+	return nil
+}
+
+// markdownFiles expands directories in paths to the markdown files in them
+func markdownFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && path != p && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".md" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// checkFile checks every link and image in a markdown file, returning the
+// broken ones and, unless fetching, the external ones
+func (c *checker) checkFile(file string) ([]problem, []linkRef, error) {
+	input, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	links, err := findLinks(input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", file, err)
+	}
+	var problems []problem
+	var external []linkRef
+	for _, l := range links {
+		u, err := url.Parse(l.dest)
+		if err != nil {
+			problems = append(problems, problem{file, l.line, fmt.Sprintf("invalid link %q: %s", l.dest, err)})
+			continue
+		}
+		if u.Scheme != "" || u.Host != "" {
+			if !c.fetch {
+				external = append(external, l)
+			} else if msg := c.fetchURL(l.dest); msg != "" {
+				problems = append(problems, problem{file, l.line, msg})
+			}
+			continue
+		}
+		if msg := c.checkLocal(file, u, l.image); msg != "" {
+			problems = append(problems, problem{file, l.line, msg})
+		}
+	}
+	return problems, external, nil
+}
+
+// checkLocal checks a relative link, returning a message if it is broken
+func (c *checker) checkLocal(file string, u *url.URL, image bool) string {
+	target := file
+	if u.Path != "" {
+		target = filepath.Join(filepath.Dir(file), filepath.FromSlash(u.Path))
+		if _, err := os.Stat(target); err != nil {
+			kind := "link"
+			if image {
+				kind = "image"
+			}
+			return fmt.Sprintf("broken %s %q: %s does not exist", kind, u.String(), target)
+		}
+	}
+	if u.Fragment == "" || filepath.Ext(target) != ".md" {
+		return ""
+	}
+	ids, err := c.headingIDs(target)
+	if err != nil {
+		return fmt.Sprintf("can't check anchor in %q: %s", u.String(), err)
+	}
+	if !ids[u.Fragment] {
+		return fmt.Sprintf("broken anchor %q: no heading with id %q in %s", u.String(), u.Fragment, target)
+	}
+	return ""
+}
+
+// headingIDs returns the anchor IDs mdp generates for a markdown file
+func (c *checker) headingIDs(file string) (map[string]bool, error) {
+	if ids, ok := c.ids[file]; ok {
+		return ids, nil
+	}
+	input, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	_, body, err := splitFrontMatter(input)
+	if err != nil {
+		return nil, err
+	}
+	doc := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions)).Parse(body)
+	ids := map[string]bool{}
+	for _, h := range addHeadingIDs(doc) {
+		ids[h.id] = true
+	}
+	c.ids[file] = ids
+	return ids, nil
+}
+
+// fetchURL requests an external URL, returning a message if it fails
+func (c *checker) fetchURL(dest string) string {
+	resp, err := c.client.Head(dest)
+	if err != nil {
+		return fmt.Sprintf("broken external link %q: %s", dest, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Sprintf("broken external link %q: %s", dest, resp.Status)
+	}
+	return ""
+}
+
+var (
+	// linkDest matches the destination of an inline link or image, after
+	// "](", or of a reference definition, after "]:" at the start of a line
+	linkDest = regexp.MustCompile(`(\]\(|(?m:^ {0,3}\[[^\]\n]+\]:))[ \t]*(<[^>\n]*>|(?:\\.|\([^\s()]*\)|[^\s()\\])+)`)
+	// backslashEscape matches an escaped character in a destination
+	backslashEscape = regexp.MustCompile(`\\(.)`)
+)
+
+// linkSyntax type is a destination written in the source, and where
+type linkSyntax struct {
+	offset int
+	dest   string
+	// Whether it is a reference definition, which any number of links
+	// can use
+	def bool
+}
+
+// findLinks parses markdown and returns its links and images with the line
+// they are on
+//
+// blackfriday doesn't keep positions, so each link is matched in order
+// with the inline destinations in the source, or else with a reference
+// definition. Autolinks have no other syntax, so their text is searched
+// for after the previous occurrence of the same destination
+func findLinks(input []byte) ([]linkRef, error) {
+	_, body, err := splitFrontMatter(input)
+	if err != nil {
+		return nil, err
+	}
+	// Lines removed with the front matter still count towards line numbers
+	offset := bytes.Count(input, []byte("\n")) - bytes.Count(body, []byte("\n"))
+	doc := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions)).Parse(body)
+
+	var syntax []linkSyntax
+	for _, m := range linkDest.FindAllSubmatchIndex(body, -1) {
+		dest := strings.TrimSuffix(strings.TrimPrefix(string(body[m[4]:m[5]]), "<"), ">")
+		syntax = append(syntax, linkSyntax{
+			offset: m[4],
+			// Destinations in the AST have their backslash escapes removed
+			dest: backslashEscape.ReplaceAllString(dest, "$1"),
+			def:  body[m[2]+1] != '(',
+		})
+	}
+
+	var links []linkRef
+	used := make([]bool, len(syntax))
+	searchFrom := map[string]int{}
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering || (node.Type != blackfriday.Link && node.Type != blackfriday.Image) {
+			return blackfriday.GoToNext
+		}
+		dest := string(node.LinkData.Destination)
+		// Footnote references are links to the footnote list, not files
+		if node.NoteID != 0 || dest == "" {
+			return blackfriday.GoToNext
+		}
+		pos := -1
+		for idx, ls := range syntax {
+			if !ls.def && !used[idx] && ls.dest == dest {
+				pos = ls.offset
+				used[idx] = true
+				break
+			}
+		}
+		for idx := 0; pos < 0 && idx < len(syntax); idx++ {
+			if syntax[idx].def && syntax[idx].dest == dest {
+				pos = syntax[idx].offset
+			}
+		}
+		if pos < 0 {
+			start := searchFrom[dest]
+			if idx := bytes.Index(body[start:], []byte(dest)); idx >= 0 {
+				pos = start + idx
+				searchFrom[dest] = pos + len(dest)
+			}
+		}
+		line := 0
+		if pos >= 0 {
+			line = bytes.Count(body[:pos], []byte("\n")) + 1
+		}
+		links = append(links, linkRef{
+			line:  line + offset,
+			dest:  dest,
+			image: node.Type == blackfriday.Image,
+			alt:   nodeText(node),
+		})
+		return blackfriday.GoToNext
+	})
+	return links, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestCheck checks broken links, images and anchors are reported with their line
+func TestCheck(t *testing.T) {
+	var out bytes.Buffer
+	err := checkCmd([]string{"./testdata/check"}, &out)
+	if err == nil {
+		t.Fatalf("Expected an error for broken links")
+	}
+	expected := "testdata/check/doc.md:12: external https://example.com\n" +
+		"testdata/check/doc.md:8: broken link \"missing.md\": testdata/check/missing.md does not exist\n" +
+		"testdata/check/doc.md:8: broken anchor \"other.md#nope\": no heading with id \"nope\" in testdata/check/other.md\n" +
+		"testdata/check/doc.md:10: broken image \"img/none.png\": testdata/check/img/none.png does not exist\n" +
+		"testdata/check/doc.md:12: broken anchor \"#nowhere\": no heading with id \"nowhere\" in testdata/check/doc.md\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+	if err.Error() != "check: found 4 problems in 2 files" {
+		t.Errorf("Unexpected error %q", err)
+	}
+}
+
+// TestCheckClean checks a site without broken links passes
+func TestCheckClean(t *testing.T) {
+	var out bytes.Buffer
+	if err := checkCmd([]string{"./testdata/site"}, &out); err != nil {
+		t.Fatalf("Expected no problems, got %s:\n%s", err, out.String())
+	}
+	expected := "testdata/site/README.md:3: external https://example.com/page.md\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+// TestCheckNoArgs checks check needs something to check
+func TestCheckNoArgs(t *testing.T) {
+	if err := checkCmd(nil, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected error without files")
+	}
+}
+
+// TestFindLinks checks links get the line of their own syntax, not of an
+// earlier mention of the destination or of nothing at all
+func TestFindLinks(t *testing.T) {
+	input := []byte("See other.md and a_b.png first.\n\n" +
+		"[Other](other.md) and [ref][r].\n\n" +
+		"![esc](a\\_b.png)\n\n" +
+		"[r]: ref.md\n")
+	links, err := findLinks(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{"other.md": 3, "ref.md": 7, "a_b.png": 5}
+	if len(links) != len(expected) {
+		t.Fatalf("Expected %d links, got %+v", len(expected), links)
+	}
+	for _, link := range links {
+		if link.line != expected[link.dest] {
+			t.Errorf("Expected %q on line %d, got %d", link.dest, expected[link.dest], link.line)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// diffStyle highlights the changes in a diff page
+const diffStyle = `
+.diff-ins { background-color: #e6ffec; border-left: 4px solid #2da44e; }
+.diff-del { background-color: #ffebe9; border-left: 4px solid #cf222e; }
+.diff-mod { border-left: 4px solid #bf8700; }
+ins { background-color: #abf2bc; text-decoration: none; }
+del { background-color: #ffc0c0; }
+`
+
+// blockStart matches the opening tag of a block, capturing its name
+var blockStart = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9]*)`)
+
+// idAttr matches an id attribute, capturing its value
+var idAttr = regexp.MustCompile(` id="([^"]*)"`)
+
+// diffToken matches the tokens blocks are compared with for word level
+// changes: a whole tag, a run of whitespace or a word
+var diffToken = regexp.MustCompile(`<[^>]*>|\s+|[^\s<]+`)
+
+// diffOp type is one step of an edit script between two sequences
+type diffOp struct {
+	// One of '=', '-' or '+'
+	kind byte
+	// Index into the old sequence for '=' and '-', the new one for '+'
+	idx int
+}
+
+// diffCmd parses the diff subcommand flags and renders the difference
+// between two markdown files, or between a file and a git revision of it
+func diffCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	rev := fs.String("rev", "", "Compare the file with this git revision of it, e.g. HEAD~1")
+	outName := fs.String("o", "", "Write the HTML to this file, - for stdout, instead of previewing a temp file")
+	skipPreview := fs.Bool("skipPreview", false, "Create HTML file without preview in browser")
+	renderConfig := addRenderFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var oldName, newName string
+	var oldInput []byte
+	var err error
+	switch {
+	case *rev != "" && fs.NArg() == 1:
+		newName = fs.Arg(0)
+		oldName = *rev + ":" + newName
+		oldInput, err = gitShow(*rev, newName)
+	case *rev == "" && fs.NArg() == 2:
+		oldName, newName = fs.Arg(0), fs.Arg(1)
+		oldInput, err = os.ReadFile(oldName)
+	default:
+		return fmt.Errorf("diff: use mdp diff old.md new.md or mdp diff -rev REV file.md")
+	}
+	if err != nil {
+		return err
+	}
+	newInput, err := os.ReadFile(newName)
+	if err != nil {
+		return err
+	}
+	htmlData, err := renderDiff(oldInput, newInput, oldName, newName, renderConfig())
+	if err != nil {
+		return err
+	}
+	return writeOutput(htmlData, out, *outName, *skipPreview)
+}
+
+// gitShow returns the contents of file at a git revision
+func gitShow(rev, file string) ([]byte, error) {
+	// The ./ prefix makes git resolve the path from the working directory
+	spec := rev + ":./" + filepath.ToSlash(filepath.Clean(file))
+	cmd := exec.Command("git", "show", spec)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git show %s: %s", spec, strings.TrimSpace(stderr.String()))
+	}
+	return data, nil
+}
+
+// renderDiff renders both revisions through the normal pipeline and
+// returns a single page showing how the rendered document changed
+func renderDiff(oldInput, newInput []byte, oldName, newName string, conf config) ([]byte, error) {
+	oldContent, err := renderMarkdown(oldInput, conf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", oldName, err)
+	}
+	newContent, err := renderMarkdown(newInput, conf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", newName, err)
+	}
+	body := diffHTML(htmlBlocks(oldContent.blocks), htmlBlocks(newContent.blocks))
+	// Both sides may use highlighting, and the styles are identical per theme
+	style := newContent.Style
+	if style == "" {
+		style = oldContent.Style
+	}
+	return executeTemplate(conf.tFname, content{
+		Title: fmt.Sprintf("Diff: %s → %s", oldName, newName),
+		Body:  template.HTML(body),
+		Meta:  map[string]string{},
+		Style: template.CSS(diffStyle) + style,
+	})
+}
+
+// diffHTML compares two rendered bodies block by block, marking removed
+// and added blocks, and showing word level changes inside blocks that
+// were edited
+func diffHTML(oldBlocks, newBlocks []string) string {
+	ops := diffSeq(oldBlocks, newBlocks)
+	// Removed blocks mustn't repeat an ID the new version still uses
+	newIDs := map[string]bool{}
+	for _, block := range newBlocks {
+		for _, m := range idAttr.FindAllStringSubmatch(block, -1) {
+			newIDs[m[1]] = true
+		}
+	}
+	renameIDs := func(block string) string {
+		return idAttr.ReplaceAllStringFunc(block, func(attr string) string {
+			id := idAttr.FindStringSubmatch(attr)[1]
+			if !newIDs[id] {
+				return attr
+			}
+			return ` id="diff-old-` + id + `"`
+		})
+	}
+
+	var b strings.Builder
+	for idx := 0; idx < len(ops); {
+		if ops[idx].kind == '=' {
+			b.WriteString(oldBlocks[ops[idx].idx] + "\n\n")
+			idx++
+			continue
+		}
+		// Collect a run of changes, then pair removed blocks with added ones
+		var removed, added []string
+		for ; idx < len(ops) && ops[idx].kind != '='; idx++ {
+			if ops[idx].kind == '-' {
+				removed = append(removed, oldBlocks[ops[idx].idx])
+			} else {
+				added = append(added, newBlocks[ops[idx].idx])
+			}
+		}
+		// Only blocks of the same element are shown as edits, as word
+		// changes across different elements can't be nested correctly
+		for r, a := 0, 0; r < len(removed) || a < len(added); {
+			switch {
+			case r < len(removed) && a < len(added) && blockTag(removed[r]) == blockTag(added[a]):
+				b.WriteString("<div class=\"diff-mod\">\n" + diffWords(removed[r], added[a]) + "\n</div>\n\n")
+				r++
+				a++
+			case r < len(removed) && !hasBlockTag(added[a:], blockTag(removed[r])):
+				b.WriteString("<div class=\"diff-del\">\n" + renameIDs(removed[r]) + "\n</div>\n\n")
+				r++
+			default:
+				b.WriteString("<div class=\"diff-ins\">\n" + added[a] + "\n</div>\n\n")
+				a++
+			}
+		}
+	}
+	return b.String()
+}
+
+// blockTag returns the name of the element a block starts with
+func blockTag(block string) string {
+	if m := blockStart.FindStringSubmatch(block); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// hasBlockTag reports whether any of blocks starts with the element tag
+func hasBlockTag(blocks []string, tag string) bool {
+	for _, block := range blocks {
+		if blockTag(block) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlBlocks trims the top level blocks of a rendered body, dropping
+// blocks left empty, such as raw HTML removed by the sanitizer
+func htmlBlocks(body []string) []string {
+	var blocks []string
+	for _, block := range body {
+		if block = strings.TrimSpace(block); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// diffWords shows the word level changes between two versions of a block,
+// keeping the markup of the new version
+func diffWords(oldBlock, newBlock string) string {
+	oldTokens := diffToken.FindAllString(oldBlock, -1)
+	newTokens := diffToken.FindAllString(newBlock, -1)
+	var b strings.Builder
+	// Runs of removed or added text are wrapped in a single del or ins
+	open := byte(0)
+	setOpen := func(kind byte) {
+		if open == kind {
+			return
+		}
+		switch open {
+		case '-':
+			b.WriteString("</del>")
+		case '+':
+			b.WriteString("</ins>")
+		}
+		switch kind {
+		case '-':
+			b.WriteString("<del>")
+		case '+':
+			b.WriteString("<ins>")
+		}
+		open = kind
+	}
+	for _, op := range diffSeq(oldTokens, newTokens) {
+		var token string
+		if op.kind == '+' {
+			token = newTokens[op.idx]
+		} else {
+			token = oldTokens[op.idx]
+		}
+		isTag := strings.HasPrefix(token, "<")
+		switch {
+		case op.kind == '=' || isTag && op.kind == '+':
+			// Tags are never wrapped, so del and ins can't break the nesting
+			setOpen(0)
+			b.WriteString(token)
+		case isTag:
+			// Removed markup is dropped, the new version's markup wins
+		default:
+			setOpen(op.kind)
+			b.WriteString(token)
+		}
+	}
+	setOpen(0)
+	return b.String()
+}
+
+// diffSeq returns the edit script turning a into b using their longest
+// common subsequence, with removals before additions in each change
+//
+// The subsequence is found with Hirschberg's algorithm, which only keeps
+// two rows of the table at a time, so long code blocks don't need memory
+// for every pair of tokens
+func diffSeq(a, b []string) []diffOp {
+	var ops []diffOp
+	// Most edits are small, so the common ends are matched up front
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{'=', prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops = lcsOps(ops, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)
+	for idx := len(a) - suffix; idx < len(a); idx++ {
+		ops = append(ops, diffOp{'=', idx})
+	}
+	// Splitting can leave additions before removals in a change
+	for start := 0; start < len(ops); start++ {
+		end := start
+		for end < len(ops) && ops[end].kind != '=' {
+			end++
+		}
+		change := ops[start:end]
+		sort.SliceStable(change, func(i, j int) bool {
+			return change[i].kind == '-' && change[j].kind == '+'
+		})
+		start = end
+	}
+	return ops
+}
+
+// lcsOps appends the edit script turning a into b to ops, where a and b
+// start at aOff and bOff of the sequences diffed
+func lcsOps(ops []diffOp, a, b []string, aOff, bOff int) []diffOp {
+	switch {
+	case len(a) == 0:
+		for j := range b {
+			ops = append(ops, diffOp{'+', bOff + j})
+		}
+		return ops
+	case len(b) == 0:
+		for i := range a {
+			ops = append(ops, diffOp{'-', aOff + i})
+		}
+		return ops
+	case len(a) == 1:
+		for j := range b {
+			if b[j] == a[0] {
+				ops = lcsOps(ops, nil, b[:j], aOff, bOff)
+				ops = append(ops, diffOp{'=', aOff})
+				return lcsOps(ops, nil, b[j+1:], aOff, bOff+j+1)
+			}
+		}
+		ops = append(ops, diffOp{'-', aOff})
+		return lcsOps(ops, nil, b, aOff, bOff)
+	}
+	// Split b where the LCS of the first half of a with its start and of
+	// the second half with its end add up to the longest
+	mid := len(a) / 2
+	fwd := lcsRow(a[:mid], b, false)
+	bwd := lcsRow(a[mid:], b, true)
+	split := 0
+	for k := range fwd {
+		if fwd[k]+bwd[len(b)-k] > fwd[split]+bwd[len(b)-split] {
+			split = k
+		}
+	}
+	ops = lcsOps(ops, a[:mid], b[:split], aOff, bOff)
+	return lcsOps(ops, a[mid:], b[split:], aOff+mid, bOff+split)
+}
+
+// lcsRow returns the length of the LCS of a with every prefix of b, or
+// with every suffix of b matching a from its end when reverse is set
+func lcsRow(a, b []string, reverse bool) []int {
+	at := func(s []string, i int) string {
+		if reverse {
+			return s[len(s)-1-i]
+		}
+		return s[i]
+	}
+	prev := make([]int, len(b)+1)
+	row := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case at(a, i) == at(b, j):
+				row[j+1] = prev[j] + 1
+			case prev[j+1] >= row[j]:
+				row[j+1] = prev[j+1]
+			default:
+				row[j+1] = row[j]
+			}
+		}
+		prev, row = row, prev
+	}
+	return prev
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestDiff checks added, removed and edited blocks are marked up
+func TestDiff(t *testing.T) {
+	var out bytes.Buffer
+	args := []string{"-o", "-", "testdata/diff/old.md", "testdata/diff/new.md"}
+	if err := diffCmd(args, &out); err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+	for _, expected := range []string{
+		"<title>Diff: testdata/diff/old.md → testdata/diff/new.md</title>",
+		`<h1 id="notes">Notes</h1>`,
+		"<div class=\"diff-mod\">\n<p>The quick <del>brown</del><ins>red</ins> fox.</p>\n</div>",
+		"<div class=\"diff-del\">\n<p>This paragraph goes away.</p>\n</div>",
+		"<div class=\"diff-ins\">\n<p>A new paragraph.</p>\n</div>",
+		"<p>Unchanged ending.</p>",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected %q in result:\n%s", expected, html)
+		}
+	}
+}
+
+// TestDiffWordsMarkup checks changed markup never splits a del or ins
+func TestDiffWordsMarkup(t *testing.T) {
+	got := diffWords("<p>one two</p>", "<p>one <em>two</em> three</p>")
+	expected := "<p>one <em>two</em><ins> three</ins></p>"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+// TestDiffArgs checks the diff subcommand rejects a wrong number of files
+func TestDiffArgs(t *testing.T) {
+	var out bytes.Buffer
+	if err := diffCmd([]string{"testdata/diff/old.md"}, &out); err == nil {
+		t.Errorf("Expected error for a single file without -rev")
+	}
+}
+
+// TestDiffBlocks checks blocks come from the AST, so code with blank
+// lines stays whole, and removed blocks don't repeat IDs still in use
+func TestDiffBlocks(t *testing.T) {
+	oldInput := "## Setup\n\n```\na\n\nb\n```\n\nLast.\n"
+	newInput := "```\na\n\nc\n```\n\nLast.\n\n## Setup\n"
+	result, err := renderDiff([]byte(oldInput), []byte(newInput), "old.md", "new.md", config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(result)
+	for _, expected := range []string{
+		"<div class=\"diff-del\">\n<h2 id=\"diff-old-setup\">Setup</h2>\n</div>",
+		"<div class=\"diff-mod\">\n<pre><code>a\n\n<del>b</del><ins>c</ins>\n</code></pre>\n</div>",
+		"<div class=\"diff-ins\">\n<h2 id=\"setup\">Setup</h2>\n</div>",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected %q in result:\n%s", expected, html)
+		}
+	}
+	if n := strings.Count(html, `id="setup"`); n != 1 {
+		t.Errorf("Expected one element with id setup, got %d:\n%s", n, html)
+	}
+}
+
+// TestDiffSeq checks the edit script turns a into b, keeps a longest common
+// subsequence and puts removals before additions in each change
+func TestDiffSeq(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	words := func(n int) []string {
+		s := make([]string, n)
+		for i := range s {
+			s[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return s
+	}
+	for run := 0; run < 200; run++ {
+		a, b := words(rnd.Intn(30)), words(rnd.Intn(30))
+		ops := diffSeq(a, b)
+		var got []string
+		same := 0
+		for idx, op := range ops {
+			switch op.kind {
+			case '=':
+				got = append(got, a[op.idx])
+				same++
+			case '+':
+				got = append(got, b[op.idx])
+			case '-':
+				if idx > 0 && ops[idx-1].kind == '+' {
+					t.Errorf("Removal after addition diffing %v and %v", a, b)
+				}
+			}
+		}
+		if strings.Join(got, "") != strings.Join(b, "") {
+			t.Fatalf("Script for %v and %v gives %v", a, b, got)
+		}
+		// The full table is fine for inputs this small
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] > lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		if same != lcs[0][0] {
+			t.Errorf("Expected %d common tokens diffing %v and %v, got %d", lcs[0][0], a, b, same)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultEmbedWarn is the size above which an embedded file gets a warning,
+// most mail servers reject attachments larger than this
+const defaultEmbedWarn = 10 << 20
+
+var (
+	// imgSrc matches the src attribute of img tags
+	imgSrc = regexp.MustCompile(`(<img\b[^>]*?\bsrc=")([^"]+)(")`)
+	// stylesheetLink matches link tags pulling in a stylesheet
+	stylesheetLink = regexp.MustCompile(`<link\b[^>]*\brel="stylesheet"[^>]*>`)
+	// linkHref matches the href attribute inside a link tag
+	linkHref = regexp.MustCompile(`\bhref="([^"]+)"`)
+)
+
+// embedResources inlines local images as data URIs and local stylesheets
+// as style tags, so the HTML keeps working once it's moved on its own
+//
+// Relative paths are resolved from baseDir, the directory of the markdown
+// file. Remote resources are left alone since they work from anywhere.
+// Images and stylesheets outside baseDir are left alone too, with a
+// warning to errOut, so a document can't pull arbitrary files from the
+// disk into the page
+func embedResources(htmlData []byte, baseDir string, errOut io.Writer) ([]byte, error) {
+	var embedErr error
+	htmlData = imgSrc.ReplaceAllFunc(htmlData, func(tag []byte) []byte {
+		m := imgSrc.FindSubmatch(tag)
+		target, ok := localPath(string(m[2]), baseDir)
+		if !ok || embedErr != nil {
+			return tag
+		}
+		inside, err := withinDir(target, baseDir)
+		if err != nil {
+			embedErr = fmt.Errorf("embedding image: %w", err)
+			return tag
+		}
+		if !inside {
+			fmt.Fprintf(errOut, "warning: not embedding %s, it is outside %s\n", m[2], baseDir)
+			return tag
+		}
+		data, err := os.ReadFile(target)
+		if err != nil {
+			embedErr = fmt.Errorf("embedding image: %w", err)
+			return tag
+		}
+		uri := fmt.Sprintf("data:%s;base64,%s", mimeType(target, data), base64.StdEncoding.EncodeToString(data))
+		return []byte(string(m[1]) + uri + string(m[3]))
+	})
+	if embedErr != nil {
+		return nil, embedErr
+	}
+
+	htmlData = stylesheetLink.ReplaceAllFunc(htmlData, func(tag []byte) []byte {
+		m := linkHref.FindSubmatch(tag)
+		if m == nil || embedErr != nil {
+			return tag
+		}
+		target, ok := localPath(string(m[1]), baseDir)
+		if !ok {
+			return tag
+		}
+		inside, err := withinDir(target, baseDir)
+		if err != nil {
+			embedErr = fmt.Errorf("embedding stylesheet: %w", err)
+			return tag
+		}
+		if !inside {
+			fmt.Fprintf(errOut, "warning: not embedding %s, it is outside %s\n", m[1], baseDir)
+			return tag
+		}
+		css, err := os.ReadFile(target)
+		if err != nil {
+			embedErr = fmt.Errorf("embedding stylesheet: %w", err)
+			return tag
+		}
+		return []byte("<style>\n" + string(css) + "</style>")
+	})
+	if embedErr != nil {
+		return nil, embedErr
+	}
+	return htmlData, nil
+}
+
+// localPath resolves a relative URL to a file path, returning false for
+// remote and data URLs
+func localPath(ref, baseDir string) (string, bool) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	return filepath.Join(baseDir, filepath.FromSlash(u.Path)), true
+}
+
+// withinDir reports whether target is dir or below it once symlinks
+// are resolved
+func withinDir(target, dir string) (bool, error) {
+	target, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return false, err
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// mimeType guesses the type of an embedded file from its extension,
+// falling back to sniffing its content
+func mimeType(name string, data []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
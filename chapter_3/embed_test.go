@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunEmbed checks local images and stylesheets are inlined
+func TestRunEmbed(t *testing.T) {
+	var mockStdOut bytes.Buffer
+	conf := config{
+		tFname: "./testdata/embed/template.html.tmpl",
+		embed:  true,
+	}
+	if err := run("./testdata/embed/doc.md", nil, &mockStdOut, true, conf); err != nil {
+		t.Fatal(err)
+	}
+	resultFile := strings.TrimSpace(mockStdOut.String())
+	defer os.Remove(resultFile)
+	result, err := os.ReadFile(resultFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(result)
+	for _, expected := range []string{
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="dot"/>`,
+		`<img src="https://example.com/remote.png" alt="remote"/>`,
+		"<style>\nbody { color: #333; }\n</style>",
+		`<link rel="stylesheet" href="https://example.com/site.css">`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected %q in result:\n%s", expected, html)
+		}
+	}
+}
+
+// TestEmbedMissingImage checks a missing local image is an error, not a broken file
+func TestEmbedMissingImage(t *testing.T) {
+	htmlData := []byte(`<p><img src="missing.png" alt="x"/></p>`)
+	if _, err := embedResources(htmlData, "./testdata/embed", io.Discard); err == nil {
+		t.Errorf("Expected error for missing image")
+	}
+}
+
+// TestEmbedOutsideDir checks images and stylesheets outside the markdown
+// file's directory are left alone with a warning
+func TestEmbedOutsideDir(t *testing.T) {
+	dir := t.TempDir()
+	doc := filepath.Join(dir, "docs")
+	if err := os.Mkdir(doc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.png"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.css"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A symlink inside the directory pointing out of it is refused too
+	if err := os.Symlink(filepath.Join(dir, "secret.png"), filepath.Join(doc, "link.png")); err != nil {
+		t.Fatal(err)
+	}
+	htmlData := []byte(`<link rel="stylesheet" href="../secret.css">` +
+		`<img src="../secret.png" alt="a"/><img src="link.png" alt="b"/>`)
+	var warnings bytes.Buffer
+	result, err := embedResources(htmlData, doc, &warnings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, htmlData) {
+		t.Errorf("Expected the images and stylesheet to be left alone, got:\n%s", result)
+	}
+	if n := strings.Count(warnings.String(), "warning: not embedding"); n != 3 {
+		t.Errorf("Expected 3 warnings, got:\n%s", warnings.String())
+	}
+}
+
+// TestRunEmbedWarn checks the size warning goes to the configured writer
+func TestRunEmbedWarn(t *testing.T) {
+	var warnings bytes.Buffer
+	conf := config{
+		tFname:    "./testdata/embed/template.html.tmpl",
+		embed:     true,
+		embedWarn: 10,
+		outName:   "-",
+		errOut:    &warnings,
+	}
+	if err := run("./testdata/embed/doc.md", nil, io.Discard, true, conf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(warnings.String(), "warning: embedded file is ") {
+		t.Errorf("Expected a size warning, got %q", warnings.String())
+	}
+}
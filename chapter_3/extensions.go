@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// extTaskLists is the name of the task list extension, which blackfriday
+// doesn't support so it's handled by addTaskLists instead of a flag bit
+const extTaskLists = "tasklists"
+
+// extensionNames maps the names accepted by -ext to blackfriday extensions
+var extensionNames = map[string]blackfriday.Extensions{
+	"tables":          blackfriday.Tables,
+	"footnotes":       blackfriday.Footnotes,
+	"strikethrough":   blackfriday.Strikethrough,
+	"autolinks":       blackfriday.Autolink,
+	"definitionlists": blackfriday.DefinitionLists,
+	"hardlinebreaks":  blackfriday.HardLineBreak,
+}
+
+// Markup for rendered task list checkboxes
+const (
+	taskOpen = `<input type="checkbox" disabled="">`
+	taskDone = `<input type="checkbox" checked="" disabled="">`
+)
+
+// taskItem matches the start of a rendered task list item, in tight and
+// loose lists
+var taskItem = regexp.MustCompile(`<li>(<p>)?\[[ xX]\] `)
+
+// parseExtensions turns a comma separated list of extension names into
+// blackfriday extensions, starting from blackfriday.CommonExtensions
+//
+// A name prefixed with "-" turns the extension off, so "footnotes,-tables"
+// adds footnotes and removes tables. The second result reports whether
+// task lists are enabled
+func parseExtensions(list string) (blackfriday.Extensions, bool, error) {
+	ext := blackfriday.CommonExtensions
+	taskLists := false
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		enable := !strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if name == extTaskLists {
+			taskLists = enable
+			continue
+		}
+		bit, ok := extensionNames[name]
+		if !ok {
+			return 0, false, fmt.Errorf("unknown extension %q, available extensions: %s",
+				name, strings.Join(extensionList(), ", "))
+		}
+		if enable {
+			ext |= bit
+		} else {
+			ext &^= bit
+		}
+	}
+	return ext, taskLists, nil
+}
+
+// extensionList returns the sorted names accepted by -ext
+func extensionList() []string {
+	names := []string{extTaskLists}
+	for name := range extensionNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// addTaskLists turns list items starting with "[ ]" or "[x]" into GitHub
+// style task list items with a disabled checkbox
+//
+// It runs after sanitization like insertTOC, so no policy has to allow
+// input elements that raw HTML could then use too
+func addTaskLists(blocks []string) []string {
+	for idx, block := range blocks {
+		blocks[idx] = taskItem.ReplaceAllStringFunc(block, func(item string) string {
+			checkbox := taskOpen
+			if !strings.HasSuffix(item, "[ ] ") {
+				checkbox = taskDone
+			}
+			return item[:strings.LastIndex(item, "[")] + checkbox + " "
+		})
+	}
+	return blocks
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatterDelim opens and closes a YAML front matter block
+const frontMatterDelim = "---"
+
+// frontMatter type holds the fields parsed from a YAML front matter block
+type frontMatter map[string]interface{}
+
+// splitFrontMatter separates a leading YAML front matter block from the
+// markdown body
+//
+// A leading "---" is also a thematic break, so it only opens front matter
+// when a closing delimiter follows and the block between is a YAML
+// mapping. Otherwise the input is returned unchanged with a nil
+// frontMatter. A closed block that isn't valid YAML is an error rather
+// than being rendered as a paragraph of garbage
+func splitFrontMatter(input []byte) (frontMatter, []byte, error) {
+	// Normalize line endings so files saved on Windows are detected too
+	text := bytes.ReplaceAll(input, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(text, []byte(frontMatterDelim+"\n")) {
+		return nil, input, nil
+	}
+	lines := strings.SplitAfter(string(text), "\n")
+	for idx := 1; idx < len(lines); idx++ {
+		// YAML also allows "..." to end a document
+		line := strings.TrimRight(lines[idx], " \t\n")
+		if line != frontMatterDelim && line != "..." {
+			continue
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(strings.Join(lines[1:idx], "")), &doc); err != nil {
+			return nil, nil, fmt.Errorf("malformed front matter: %w", err)
+		}
+		fm := frontMatter{}
+		// An empty block has no content at all
+		if len(doc.Content) > 0 {
+			if doc.Content[0].Kind != yaml.MappingNode {
+				return nil, input, nil
+			}
+			if err := doc.Decode(&fm); err != nil {
+				return nil, nil, fmt.Errorf("malformed front matter: %w", err)
+			}
+		}
+		return fm, []byte(strings.Join(lines[idx+1:], "")), nil
+	}
+	return nil, input, nil
+}
+
+// title returns the title field, if the front matter has one
+func (fm frontMatter) title() string {
+	if t, ok := fm["title"]; ok {
+		return metaString(t)
+	}
+	return ""
+}
+
+// meta converts every field except the title to a string, so they can be
+// rendered as meta tags by templates
+func (fm frontMatter) meta() map[string]string {
+	meta := map[string]string{}
+	for name, value := range fm {
+		if name == "title" {
+			continue
+		}
+		meta[name] = metaString(value)
+	}
+	return meta
+}
+
+// metaString formats a YAML value for a meta tag, joining lists with commas
+func metaString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, metaString(item))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestSplitFrontMatter checks front matter is detected, parsed and stripped
+func TestSplitFrontMatter(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		body      string
+		title     string
+		meta      map[string]string
+		expectErr bool
+	}{
+		{name: "NoFrontMatter", input: "# Title\n", body: "# Title\n",
+			meta: map[string]string{}},
+		{name: "RuleLaterInFile", input: "Text\n---\nMore\n", body: "Text\n---\nMore\n",
+			meta: map[string]string{}},
+		{name: "Fields", input: "---\ntitle: Doc\nauthor: Me\ntags:\n  - a\n  - b\n---\nBody\n",
+			body: "Body\n", title: "Doc", meta: map[string]string{"author": "Me", "tags": "a, b"}},
+		{name: "DotsClose", input: "---\ndate: 2022-11-01\n...\nBody\n", body: "Body\n",
+			meta: map[string]string{"date": "2022-11-01"}},
+		{name: "WindowsLineEndings", input: "---\r\ntitle: Doc\r\n---\r\nBody\r\n", body: "Body\n",
+			title: "Doc", meta: map[string]string{}},
+		{name: "Unterminated", input: "---\ntitle: Doc\nBody\n", body: "---\ntitle: Doc\nBody\n",
+			meta: map[string]string{}},
+		{name: "LeadingRule", input: "---\nSome text\n---\nMore\n", body: "---\nSome text\n---\nMore\n",
+			meta: map[string]string{}},
+		{name: "Empty", input: "---\n---\nBody\n", body: "Body\n", meta: map[string]string{}},
+		{name: "Malformed", input: "---\ntitle: [Doc\n---\nBody\n", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fm, body, err := splitFrontMatter([]byte(tc.input))
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tc.body {
+				t.Errorf("Expected body %q, got %q instead", tc.body, body)
+			}
+			if fm.title() != tc.title {
+				t.Errorf("Expected title %q, got %q instead", tc.title, fm.title())
+			}
+			meta := fm.meta()
+			if len(meta) != len(tc.meta) {
+				t.Errorf("Expected meta %v, got %v instead", tc.meta, meta)
+			}
+			for name, value := range tc.meta {
+				if meta[name] != value {
+					t.Errorf("Expected meta %q to be %q, got %q instead", name, value, meta[name])
+				}
+			}
+		})
+	}
+}
+
+// TestParseContentFrontMatter checks front matter ends up in the head, not the body
+func TestParseContentFrontMatter(t *testing.T) {
+	input, err := os.ReadFile("./testdata/frontmatter.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := parseContent(input, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile("./testdata/frontmatter.md.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, result) {
+		t.Logf("Golden:\n%s\n", expected)
+		t.Logf("Result:\n%s\n", result)
+		t.Errorf("Result content does not match golden file")
+	}
+}
@@ -3,9 +3,12 @@ module rohtisingh/mdp
 go 1.19
 
 require (
+	github.com/alecthomas/chroma/v2 v2.14.0 // direct
 	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/gorilla/css v1.0.0 // indirect
 	github.com/microcosm-cc/bluemonday v1.0.21 // direct
 	github.com/russross/blackfriday/v2 v2.1.0 // direct
 	golang.org/x/net v0.0.0-20221002022538-bcab6841153b // indirect
+	gopkg.in/yaml.v3 v3.0.1 // direct
 )
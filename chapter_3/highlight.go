@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// highlightClass matches the class names chroma puts on highlighted code
+var highlightClass = regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)
+
+// highlighter type is a blackfriday renderer that highlights fenced code
+// blocks with a language tag and renders everything else as plain HTML
+//
+// Highlighting uses CSS classes rather than inline styles, so the
+// sanitizer only has to allow class attributes and the theme lives in
+// a single stylesheet
+type highlighter struct {
+	*blackfriday.HTMLRenderer
+	formatter *chromahtml.Formatter
+	style     *chroma.Style
+	// Whether any block was highlighted, so the stylesheet is only
+	// added to documents that need it
+	used bool
+}
+
+// newHighlighter creates a highlighter using the named chroma style
+func newHighlighter(theme string) (*highlighter, error) {
+	style, ok := styles.Registry[theme]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q, available themes: %s",
+			theme, strings.Join(styles.Names(), ", "))
+	}
+	return &highlighter{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			Flags: blackfriday.CommonHTMLFlags,
+		}),
+		formatter: chromahtml.New(chromahtml.WithClasses(true)),
+		style:     style,
+	}, nil
+}
+
+// RenderNode highlights code blocks whose language chroma knows, and hands
+// every other node to the embedded HTMLRenderer
+func (h *highlighter) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if node.Type != blackfriday.CodeBlock || len(node.Info) == 0 {
+		return h.HTMLRenderer.RenderNode(w, node, entering)
+	}
+	// The info string may hold more than the language, e.g. "go {linenos}"
+	lexer := lexers.Get(strings.Fields(string(node.Info))[0])
+	if lexer == nil {
+		return h.HTMLRenderer.RenderNode(w, node, entering)
+	}
+	iterator, err := lexer.Tokenise(nil, string(node.Literal))
+	if err != nil {
+		return h.HTMLRenderer.RenderNode(w, node, entering)
+	}
+	// Format into a buffer so a failure can fall back to the plain block
+	var buf bytes.Buffer
+	if err := h.formatter.Format(&buf, h.style, iterator); err != nil {
+		return h.HTMLRenderer.RenderNode(w, node, entering)
+	}
+	h.used = true
+	io.WriteString(w, "\n")
+	w.Write(buf.Bytes())
+	io.WriteString(w, "\n")
+	return blackfriday.GoToNext
+}
+
+// css returns the stylesheet for the theme, or an empty string if no
+// block was highlighted
+func (h *highlighter) css() (string, error) {
+	if !h.used {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := h.formatter.WriteCSS(&buf, h.style); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// allowHighlighting extends a sanitizer policy to keep the class
+// attributes used by highlighted code
+func allowHighlighting(p *bluemonday.Policy) *bluemonday.Policy {
+	p.AllowAttrs("class").Matching(highlightClass).OnElements("pre", "span")
+	return p
+}
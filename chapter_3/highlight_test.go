@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestHighlight checks fenced blocks are highlighted and survive sanitization
+func TestHighlight(t *testing.T) {
+	input, err := os.ReadFile("./testdata/code.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := parseContent(input, config{theme: "github"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(result)
+	// Go, shell, YAML and JSON are highlighted, the unknown language is not
+	if n := strings.Count(html, `<pre class="chroma">`); n != 4 {
+		t.Errorf("Expected 4 highlighted blocks, got %d:\n%s", n, html)
+	}
+	if !strings.Contains(html, `<span class="kd">func</span>`) {
+		t.Errorf("Expected Go keyword to be highlighted:\n%s", html)
+	}
+	if !strings.Contains(html, "<pre><code>plain text") {
+		t.Errorf("Expected unknown language to render as a plain block:\n%s", html)
+	}
+	if strings.Contains(html, "<script>alert") {
+		t.Errorf("Expected code to be escaped:\n%s", html)
+	}
+	if !strings.Contains(html, "<style>") || !strings.Contains(html, ".chroma .kd") {
+		t.Errorf("Expected theme stylesheet in the head:\n%s", html)
+	}
+}
+
+// TestHighlightDisabled checks no theme means plain blocks and no stylesheet
+func TestHighlightDisabled(t *testing.T) {
+	input, err := os.ReadFile("./testdata/code.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := parseContent(input, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(result), "chroma") || strings.Contains(string(result), "<style>") {
+		t.Errorf("Expected no highlighting:\n%s", result)
+	}
+}
+
+// TestHighlightSanitized checks allowing classes doesn't let other markup through
+func TestHighlightSanitized(t *testing.T) {
+	input := []byte("<span class=\"kd\" onclick=\"alert(1)\" style=\"color:red\">x</span><script>alert(2)</script>\n\n```go\nvar x\n```\n")
+	result, err := parseContent(input, config{theme: "monokai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(result)
+	for _, bad := range []string{"onclick", "color:red", "<script>alert(2)"} {
+		if strings.Contains(html, bad) {
+			t.Errorf("Expected %q to be sanitized:\n%s", bad, html)
+		}
+	}
+	if !strings.Contains(html, `<span class="kd">x</span>`) {
+		t.Errorf("Expected class attribute to be kept:\n%s", html)
+	}
+}
+
+// TestHighlightUnknownTheme checks an unknown theme is reported
+func TestHighlightUnknownTheme(t *testing.T) {
+	if _, err := parseContent([]byte("# Doc\n"), config{theme: "no-such-theme"}); err == nil {
+		t.Errorf("Expected error for unknown theme")
+	}
+}
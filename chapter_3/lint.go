@@ -0,0 +1,707 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+var (
+	// atxHeading matches a "# Heading" line
+	atxHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(\s|$)`)
+	// setextUnderline matches the line under a setext heading
+	setextUnderline = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	// listItem matches an unordered list item, capturing its marker
+	listItem = regexp.MustCompile(`^(\s*)([-*+])\s+\S`)
+	// thematicBreak matches a "* * *" style horizontal rule
+	thematicBreak = regexp.MustCompile(`^ {0,3}([-*_])(\s*[-*_]){2,}\s*$`)
+	// htmlTag matches a raw HTML tag, but not a <https://...> autolink
+	htmlTag = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9-]*(\s[^>]*)?/?>`)
+	// fence matches the opening or closing line of a fenced code block
+	fence = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+)
+
+// lintIssue type is a single rule violation in a file
+type lintIssue struct {
+	line int
+	msg  string
+}
+
+// lintRule type is a style check mdp lint can run
+type lintRule struct {
+	name string
+	desc string
+	// check returns the violations of the rule in a document
+	check func(d *lintDoc) []lintIssue
+	// fix rewrites d.lines so the rule passes, nil if the rule can't be
+	// fixed without a human deciding how
+	fix func(d *lintDoc)
+}
+
+// lintDoc type is a markdown file parsed for linting
+type lintDoc struct {
+	// Every line of the file without its line ending
+	lines []string
+	// Index of the first line after the front matter
+	first int
+	// Lines that are part of a code block, fences included, or of a raw
+	// HTML block, which no rule looks inside
+	code []bool
+	// Column ranges of the `code` spans on each line, backticks included
+	spans map[int][][2]int
+	// Parsed markdown body
+	doc *blackfriday.Node
+	// Links and images with their lines
+	links []linkRef
+	// Whether the file uses CRLF line endings
+	crlf bool
+}
+
+// lintRules lists every rule in the order they are reported
+var lintRules = []lintRule{
+	{
+		name:  "heading-increment",
+		desc:  "heading levels only increase one at a time",
+		check: checkHeadingIncrement,
+	},
+	{
+		name:  "duplicate-heading",
+		desc:  "no two headings have the same text",
+		check: checkDuplicateHeading,
+	},
+	{
+		name:  "trailing-whitespace",
+		desc:  "lines don't end in whitespace, except a two space line break",
+		check: checkTrailingWhitespace,
+		fix:   fixTrailingWhitespace,
+	},
+	{
+		name:  "image-alt",
+		desc:  "images have alternative text",
+		check: checkImageAlt,
+	},
+	{
+		name:  "bare-url",
+		desc:  "URLs are links or wrapped in <>",
+		check: checkBareURL,
+		fix:   fixBareURL,
+	},
+	{
+		name:  "list-marker",
+		desc:  "unordered lists use the same marker throughout the file",
+		check: checkListMarker,
+		fix:   fixListMarker,
+	},
+}
+
+// lintCmd parses the lint subcommand flags and lints every markdown file
+// given, directories are searched recursively
+func lintCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	enable := fs.String("rules", "all", "Comma separated rules to run")
+	disable := fs.String("disable", "", "Comma separated rules to skip")
+	fix := fs.Bool("fix", false, "Fix the violations of fixable rules in place")
+	list := fs.Bool("list", false, "List the available rules and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *list {
+		for _, r := range lintRules {
+			fixable := ""
+			if r.fix != nil {
+				fixable = " (fixable)"
+			}
+			fmt.Fprintf(out, "%-20s %s%s\n", r.name, r.desc, fixable)
+		}
+		return nil
+	}
+	rules, err := selectRules(*enable, *disable)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("lint: no files or directories given")
+	}
+	files, err := markdownFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, f := range files {
+		problems, err := lintFile(f, rules, *fix)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			fmt.Fprintln(out, p)
+		}
+		count += len(problems)
+	}
+	if count > 0 {
+		return fmt.Errorf("lint: found %d problems in %d files", count, len(files))
+	}
+	return nil
+}
+
+// selectRules returns the rules named in enable, or every rule for "all",
+// minus the ones named in disable
+func selectRules(enable, disable string) ([]lintRule, error) {
+	known := map[string]bool{}
+	for _, r := range lintRules {
+		known[r.name] = true
+	}
+	names := func(list string) (map[string]bool, error) {
+		set := map[string]bool{}
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !known[name] && name != "all" {
+				return nil, fmt.Errorf("lint: unknown rule %q", name)
+			}
+			set[name] = true
+		}
+		return set, nil
+	}
+	enabled, err := names(enable)
+	if err != nil {
+		return nil, err
+	}
+	disabled, err := names(disable)
+	if err != nil {
+		return nil, err
+	}
+	var rules []lintRule
+	for _, r := range lintRules {
+		if (enabled["all"] || enabled[r.name]) && !disabled[r.name] {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+// lintFile runs rules against a file, fixing it first if fix is set, and
+// returns the violations left
+func lintFile(file string, rules []lintRule, fix bool) ([]problem, error) {
+	input, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	d, err := parseLintDoc(input)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if fix {
+		for _, r := range rules {
+			if r.fix != nil {
+				r.fix(d)
+			}
+		}
+		if fixed := d.bytes(); !bytes.Equal(fixed, input) {
+			if err := os.WriteFile(file, fixed, 0644); err != nil {
+				return nil, err
+			}
+			// Reparse so the remaining violations have the right lines
+			if d, err = parseLintDoc(fixed); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	var problems []problem
+	for _, r := range rules {
+		for _, issue := range r.check(d) {
+			problems = append(problems, problem{file, issue.line, r.name + ": " + issue.msg})
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].line < problems[j].line
+	})
+	return problems, nil
+}
+
+// parseLintDoc splits input into lines and parses its markdown body
+func parseLintDoc(input []byte) (*lintDoc, error) {
+	_, body, err := splitFrontMatter(input)
+	if err != nil {
+		return nil, err
+	}
+	links, err := findLinks(input)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.ReplaceAll(string(input), "\r\n", "\n")
+	d := &lintDoc{
+		lines: strings.Split(strings.TrimSuffix(text, "\n"), "\n"),
+		doc:   blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions)).Parse(body),
+		links: links,
+		crlf:  strings.Contains(string(input), "\r\n"),
+	}
+	d.first = len(d.lines) - len(strings.Split(strings.TrimSuffix(string(body), "\n"), "\n"))
+	if len(body) == 0 {
+		d.first = len(d.lines)
+	}
+
+	d.code = make([]bool, len(d.lines))
+	open := ""
+	for idx := d.first; idx < len(d.lines); idx++ {
+		m := fence.FindStringSubmatch(d.lines[idx])
+		switch {
+		case open == "" && m != nil:
+			open = m[1]
+		case open != "" && m != nil && m[1][0] == open[0] && len(m[1]) >= len(open) &&
+			strings.TrimSpace(strings.TrimLeft(d.lines[idx], " "+m[1][:1])) == "":
+			d.code[idx] = true
+			open = ""
+		}
+		d.code[idx] = d.code[idx] || open != ""
+	}
+	d.markBlocks()
+	d.markCodeSpans()
+	return d, nil
+}
+
+// markBlocks marks the lines of indented code blocks and raw HTML blocks
+// as code
+//
+// blackfriday doesn't keep positions, so the lines of each block in the
+// AST are found in the source in order
+func (d *lintDoc) markBlocks() {
+	from := d.first
+	d.doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering {
+			return blackfriday.GoToNext
+		}
+		var matches func(line, want string) bool
+		switch {
+		case node.Type == blackfriday.CodeBlock && !node.IsFenced:
+			matches = codeLine
+		case node.Type == blackfriday.HTMLBlock:
+			matches = htmlLine
+		default:
+			return blackfriday.GoToNext
+		}
+		block := strings.Split(strings.TrimRight(string(node.Literal), "\n"), "\n")
+		for start := from; start+len(block) <= len(d.lines); start++ {
+			matched := true
+			for n, want := range block {
+				if d.code[start+n] || !matches(d.lines[start+n], want) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				for n := range block {
+					d.code[start+n] = true
+				}
+				from = start + len(block)
+				break
+			}
+		}
+		return blackfriday.GoToNext
+	})
+}
+
+// codeLine returns whether a source line is the line want of an indented
+// code block, indented by at least four columns
+func codeLine(line, want string) bool {
+	if strings.TrimSpace(want) == "" {
+		return strings.TrimSpace(line) == ""
+	}
+	indent := strings.TrimSuffix(line, want)
+	return indent != line && strings.TrimLeft(indent, " \t") == "" &&
+		(len(indent) >= 4 || strings.Contains(indent, "\t"))
+}
+
+// htmlLine returns whether a source line is the line want of a raw HTML
+// block, which may be indented differently inside lists and quotes
+func htmlLine(line, want string) bool {
+	return strings.TrimSpace(line) == strings.TrimSpace(want)
+}
+
+// markCodeSpans finds the `code` spans of the body lines outside code
+// blocks, keeping only the ones blackfriday parsed as Code nodes
+//
+// Spans can continue on the next line but not past a blank line, so each
+// paragraph is scanned as a whole
+func (d *lintDoc) markCodeSpans() {
+	literals := map[string]bool{}
+	d.doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && node.Type == blackfriday.Code {
+			literals[strings.Join(strings.Fields(string(node.Literal)), " ")] = true
+		}
+		return blackfriday.GoToNext
+	})
+	d.spans = map[int][][2]int{}
+	var para []int
+	scan := func() {
+		d.scanCodeSpans(para, literals)
+		para = para[:0]
+	}
+	for idx := d.first; idx < len(d.lines); idx++ {
+		if d.code[idx] || strings.TrimSpace(d.lines[idx]) == "" {
+			scan()
+			continue
+		}
+		para = append(para, idx)
+	}
+	scan()
+}
+
+// scanCodeSpans marks the code spans in the lines of one paragraph
+func (d *lintDoc) scanCodeSpans(para []int, literals map[string]bool) {
+	// Every character of the paragraph with its line and column
+	type pos struct{ idx, col int }
+	var text []byte
+	var at []pos
+	for _, idx := range para {
+		for col := 0; col < len(d.lines[idx]); col++ {
+			text = append(text, d.lines[idx][col])
+			at = append(at, pos{idx, col})
+		}
+		text = append(text, '\n')
+		at = append(at, pos{idx, len(d.lines[idx])})
+	}
+	run := func(i int) int {
+		n := 0
+		for i+n < len(text) && text[i+n] == '`' {
+			n++
+		}
+		return n
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+		n := run(i)
+		if n == 0 {
+			continue
+		}
+		// The span closes at the next run of exactly as many backticks
+		end := -1
+		for j := i + n; j < len(text); j++ {
+			if m := run(j); m > 0 {
+				if m == n {
+					end = j + m
+					break
+				}
+				j += m - 1
+			}
+		}
+		if end < 0 || !literals[strings.Join(strings.Fields(string(text[i+n:end-n])), " ")] {
+			i += n - 1
+			continue
+		}
+		// Mark the span on every line it covers
+		for start := i; start < end; {
+			line := at[start].idx
+			stop := start
+			for stop < end && at[stop].idx == line {
+				stop++
+			}
+			d.spans[line] = append(d.spans[line], [2]int{at[start].col, at[stop-1].col + 1})
+			start = stop
+		}
+		i = end - 1
+	}
+}
+
+// inCodeSpan returns whether column col of line idx is inside a code span
+func (d *lintDoc) inCodeSpan(idx, col int) bool {
+	for _, span := range d.spans[idx] {
+		if col >= span[0] && col < span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// bytes joins the lines back into a file with its original line endings
+func (d *lintDoc) bytes() []byte {
+	eol := "\n"
+	if d.crlf {
+		eol = "\r\n"
+	}
+	return []byte(strings.Join(d.lines, eol) + eol)
+}
+
+// bodyLines calls fn with the index of every body line outside fenced
+// and indented code blocks
+func (d *lintDoc) bodyLines(fn func(idx int)) {
+	for idx := d.first; idx < len(d.lines); idx++ {
+		if !d.code[idx] {
+			fn(idx)
+		}
+	}
+}
+
+// lintHeading type is a heading with the line it starts on
+type lintHeading struct {
+	line  int
+	level int
+	text  string
+}
+
+// headings returns the headings of the AST paired with their lines
+//
+// blackfriday doesn't keep positions, so heading lines found in the
+// source are matched to the AST headings in order
+func (d *lintDoc) headings() []lintHeading {
+	var lines []int
+	d.bodyLines(func(idx int) {
+		line := d.lines[idx]
+		if atxHeading.MatchString(line) {
+			lines = append(lines, idx+1)
+			return
+		}
+		// A setext underline belongs to the paragraph line above it
+		if idx > d.first && setextUnderline.MatchString(line) && !d.code[idx-1] {
+			prev := d.lines[idx-1]
+			if strings.TrimSpace(prev) != "" && !atxHeading.MatchString(prev) && !listItem.MatchString(prev) {
+				lines = append(lines, idx)
+			}
+		}
+	})
+	var headings []lintHeading
+	d.doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering || node.Type != blackfriday.Heading {
+			return blackfriday.GoToNext
+		}
+		h := lintHeading{level: node.Level, text: nodeText(node)}
+		if len(headings) < len(lines) {
+			h.line = lines[len(headings)]
+		}
+		headings = append(headings, h)
+		return blackfriday.SkipChildren
+	})
+	return headings
+}
+
+// checkHeadingIncrement reports headings more than one level below the
+// heading before them
+func checkHeadingIncrement(d *lintDoc) []lintIssue {
+	var issues []lintIssue
+	prev := 0
+	for _, h := range d.headings() {
+		if prev > 0 && h.level > prev+1 {
+			issues = append(issues, lintIssue{h.line, fmt.Sprintf("heading level %d follows level %d", h.level, prev)})
+		}
+		prev = h.level
+	}
+	return issues
+}
+
+// checkDuplicateHeading reports headings with the same text as an earlier one
+func checkDuplicateHeading(d *lintDoc) []lintIssue {
+	var issues []lintIssue
+	seen := map[string]int{}
+	for _, h := range d.headings() {
+		text := strings.TrimSpace(h.text)
+		if first, ok := seen[text]; ok {
+			issues = append(issues, lintIssue{h.line, fmt.Sprintf("duplicate heading %q, first on line %d", text, first)})
+			continue
+		}
+		seen[text] = h.line
+	}
+	return issues
+}
+
+// trailingWhitespace returns whether a line ends in whitespace that isn't
+// a two space hard line break
+func trailingWhitespace(line string) bool {
+	trimmed := strings.TrimRight(line, " \t")
+	if trimmed == line {
+		return false
+	}
+	return trimmed == "" || line != trimmed+"  "
+}
+
+// checkTrailingWhitespace reports lines ending in whitespace
+func checkTrailingWhitespace(d *lintDoc) []lintIssue {
+	var issues []lintIssue
+	d.bodyLines(func(idx int) {
+		if trailingWhitespace(d.lines[idx]) {
+			issues = append(issues, lintIssue{idx + 1, "trailing whitespace"})
+		}
+	})
+	return issues
+}
+
+// fixTrailingWhitespace removes trailing whitespace
+func fixTrailingWhitespace(d *lintDoc) {
+	d.bodyLines(func(idx int) {
+		if trailingWhitespace(d.lines[idx]) {
+			d.lines[idx] = strings.TrimRight(d.lines[idx], " \t")
+		}
+	})
+}
+
+// checkImageAlt reports images without alternative text
+func checkImageAlt(d *lintDoc) []lintIssue {
+	var issues []lintIssue
+	for _, l := range d.links {
+		if l.image && strings.TrimSpace(l.alt) == "" {
+			issues = append(issues, lintIssue{l.line, fmt.Sprintf("image %q has no alt text", l.dest)})
+		}
+	}
+	return issues
+}
+
+// urlSpan type is the position of a bare URL in a line
+type urlSpan struct {
+	idx        int
+	start, end int
+}
+
+// bareURLs returns the URLs blackfriday autolinked that aren't wrapped in
+// <>, as positions in the source lines
+func (d *lintDoc) bareURLs() []urlSpan {
+	autolinks := map[string]bool{}
+	d.doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && node.Type == blackfriday.Link {
+			text, dest := nodeText(node), string(node.LinkData.Destination)
+			if text == dest || "mailto:"+text == dest {
+				autolinks[text] = true
+			}
+		}
+		return blackfriday.GoToNext
+	})
+	// Longest first, so a URL that prefixes another isn't matched inside it
+	urls := make([]string, 0, len(autolinks))
+	for u := range autolinks {
+		urls = append(urls, u)
+	}
+	sort.Slice(urls, func(i, j int) bool { return len(urls[i]) > len(urls[j]) })
+
+	var spans []urlSpan
+	d.bodyLines(func(idx int) {
+		line := d.lines[idx]
+		taken := make([]bool, len(line))
+		for _, u := range urls {
+			for from := 0; ; {
+				pos := strings.Index(line[from:], u)
+				if pos < 0 {
+					break
+				}
+				start, end := from+pos, from+pos+len(u)
+				from = end
+				if taken[start] {
+					continue
+				}
+				for n := start; n < end; n++ {
+					taken[n] = true
+				}
+				// Wrapped in <>, or the text or destination of a [link](url)
+				if start > 0 && strings.ContainsRune("<[(", rune(line[start-1])) {
+					continue
+				}
+				// Code and raw HTML tags are never rewritten
+				if d.inCodeSpan(idx, start) || inTag(line, start) {
+					continue
+				}
+				spans = append(spans, urlSpan{idx, start, end})
+			}
+		}
+	})
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].idx != spans[j].idx {
+			return spans[i].idx < spans[j].idx
+		}
+		return spans[i].start < spans[j].start
+	})
+	return spans
+}
+
+// checkBareURL reports URLs that are only links because of autolinking
+func checkBareURL(d *lintDoc) []lintIssue {
+	var issues []lintIssue
+	for _, s := range d.bareURLs() {
+		url := d.lines[s.idx][s.start:s.end]
+		issues = append(issues, lintIssue{s.idx + 1, fmt.Sprintf("bare URL %s, wrap it in <>", url)})
+	}
+	return issues
+}
+
+// fixBareURL wraps bare URLs in <>
+func fixBareURL(d *lintDoc) {
+	spans := d.bareURLs()
+	// Backwards, so earlier positions on a line stay valid
+	for n := len(spans) - 1; n >= 0; n-- {
+		s := spans[n]
+		line := d.lines[s.idx]
+		d.lines[s.idx] = line[:s.start] + "<" + line[s.start:s.end] + ">" + line[s.end:]
+	}
+}
+
+// inTag returns whether column col of line is inside a raw HTML tag,
+// such as the href of <a href="...">
+func inTag(line string, col int) bool {
+	for _, tag := range htmlTag.FindAllStringIndex(line, -1) {
+		if col > tag[0] && col < tag[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// listMarkers returns the line index of every unordered list item, and the
+// marker the first item uses
+//
+// Items come from the AST, so lines that only look like items, such as
+// inside raw HTML, are left out. blackfriday doesn't keep positions, so
+// each item is matched to the next source line starting with its marker
+func (d *lintDoc) listMarkers() ([]int, byte) {
+	var items []int
+	var want byte
+	from := d.first
+	d.doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering || node.Type != blackfriday.Item || node.ListFlags&(blackfriday.ListTypeOrdered|blackfriday.ListTypeDefinition) != 0 {
+			return blackfriday.GoToNext
+		}
+		for idx := from; idx < len(d.lines); idx++ {
+			m := listItem.FindStringSubmatch(d.lines[idx])
+			if d.code[idx] || m == nil || m[2][0] != node.BulletChar || thematicBreak.MatchString(d.lines[idx]) {
+				continue
+			}
+			items = append(items, idx)
+			if want == 0 {
+				want = node.BulletChar
+			}
+			from = idx + 1
+			break
+		}
+		return blackfriday.GoToNext
+	})
+	return items, want
+}
+
+// checkListMarker reports list items not using the file's first marker
+func checkListMarker(d *lintDoc) []lintIssue {
+	var issues []lintIssue
+	items, want := d.listMarkers()
+	for _, idx := range items {
+		m := listItem.FindStringSubmatch(d.lines[idx])
+		if m[2][0] != want {
+			issues = append(issues, lintIssue{idx + 1, fmt.Sprintf("list marker %q, the file uses %q", m[2], string(want))})
+		}
+	}
+	return issues
+}
+
+// fixListMarker changes every list marker to the file's first one
+func fixListMarker(d *lintDoc) {
+	items, want := d.listMarkers()
+	for _, idx := range items {
+		line := d.lines[idx]
+		m := listItem.FindStringSubmatchIndex(line)
+		d.lines[idx] = line[:m[4]] + string(want) + line[m[5]:]
+	}
+}
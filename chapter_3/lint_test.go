@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLint checks every rule reports its violation with the right line
+func TestLint(t *testing.T) {
+	var out bytes.Buffer
+	err := lintCmd([]string{"./testdata/lint"}, &out)
+	if err == nil {
+		t.Fatalf("Expected an error for lint problems")
+	}
+	expected := "testdata/lint/doc.md:6: heading-increment: heading level 3 follows level 1\n" +
+		"testdata/lint/doc.md:8: trailing-whitespace: trailing whitespace\n" +
+		"testdata/lint/doc.md:10: bare-url: bare URL https://example.com/docs, wrap it in <>\n" +
+		"testdata/lint/doc.md:12: image-alt: image \"img/logo.png\" has no alt text\n" +
+		"testdata/lint/doc.md:15: list-marker: list marker \"*\", the file uses \"-\"\n" +
+		"testdata/lint/doc.md:23: duplicate-heading: duplicate heading \"Guide\", first on line 4\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+	if err.Error() != "lint: found 6 problems in 1 files" {
+		t.Errorf("Unexpected error %q", err)
+	}
+}
+
+// TestLintRules checks rules can be selected and disabled
+func TestLintRules(t *testing.T) {
+	var out bytes.Buffer
+	args := []string{"-rules", "image-alt,list-marker", "-disable", "list-marker", "./testdata/lint"}
+	if err := lintCmd(args, &out); err == nil {
+		t.Fatalf("Expected an error for lint problems")
+	}
+	expected := "testdata/lint/doc.md:12: image-alt: image \"img/logo.png\" has no alt text\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+	if err := lintCmd([]string{"-rules", "nope", "./testdata/lint"}, &out); err == nil {
+		t.Errorf("Expected error for unknown rule")
+	}
+}
+
+// TestLintFix checks the fixable rules are fixed in place and only the
+// others are still reported
+func TestLintFix(t *testing.T) {
+	input, err := os.ReadFile("./testdata/lint/doc.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "doc.md")
+	if err := os.WriteFile(file, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := lintCmd([]string{"-fix", file}, &out); err == nil {
+		t.Fatalf("Expected an error for unfixable problems")
+	}
+	for _, rule := range []string{"trailing-whitespace", "bare-url", "list-marker"} {
+		if strings.Contains(out.String(), rule) {
+			t.Errorf("Expected %s to be fixed, got:\n%s", rule, out.String())
+		}
+	}
+	if n := strings.Count(out.String(), "\n"); n != 3 {
+		t.Errorf("Expected 3 problems left, got:\n%s", out.String())
+	}
+
+	fixed, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Some text with trailing space\nand a hard break  \n",
+		"a bare URL <https://example.com/docs> and <https://example.com/ok>.",
+		"- one\n- two\n- three\n",
+		"echo \"code keeps its trailing space\" \n* not a list\n",
+		"Visit [https://example.com/docs](https://example.com/docs).",
+	} {
+		if !strings.Contains(string(fixed), expected) {
+			t.Errorf("Expected %q in fixed file:\n%s", expected, fixed)
+		}
+	}
+}
+
+// TestLintFixCode checks -fix never edits code spans or indented code
+func TestLintFixCode(t *testing.T) {
+	input := "Run `curl https://example.com` or ``see `https://example.com/a` ``.\n\n" +
+		"- one\n- two\n\nSome code:\n\n" +
+		"    * not a list\n    https://example.com/b\n\n" +
+		"* fixed\n"
+	file := filepath.Join(t.TempDir(), "code.md")
+	if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := lintCmd([]string{"-fix", file}, &out); err != nil {
+		t.Fatalf("Expected no problems left, got %s:\n%s", err, out.String())
+	}
+	fixed, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(input, "* fixed", "- fixed", 1)
+	if string(fixed) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, fixed)
+	}
+}
+
+func TestLintFixHTML(t *testing.T) {
+	input := "See <a href=\"https://example.com\">the site</a> or https://example.com.\n\n" +
+		"<div>\n+ not a list\n</div>\n\n" +
+		"- a\n- b\n"
+	file := filepath.Join(t.TempDir(), "html.md")
+	if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := lintCmd([]string{"-fix", file}, &out); err != nil {
+		t.Fatalf("Expected no problems left, got %s:\n%s", err, out.String())
+	}
+	fixed, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(input, " https://example.com.", " <https://example.com>.", 1)
+	if string(fixed) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, fixed)
+	}
+}
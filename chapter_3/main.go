@@ -2,41 +2,117 @@ package main
 
 import (
 	"bytes"
+	_ "embed"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/microcosm-cc/bluemonday"
 	"github.com/russross/blackfriday/v2"
 )
 
-// Constants
+// defaultTemplate is the html/template used when no template is given
+//
+// It is embedded so the binary works on its own, while still being
+// easy to read and copy as a starting point for custom templates
+//
+//go:embed template.html.tmpl
+var defaultTemplate string
+
+// stdio is the file name standing for stdin as input and stdout as output
+const stdio = "-"
+
+// Output formats of the main command
 const (
-	// header containers the HTML header required to view
-	// html in a browser
-	header = `
-<!DOCTYPE html>
-<html>
-	<head>
-		<meta http-equiv="content-type" content="text/html"; charset=utf-8">
-		<title>Markdown Preview Tool</title>
-	</head>
-	<body>
-`
-	footer = `
-	</body>
-</html>
-`
+	formatHTML = "html"
+	formatText = "text"
+	formatMan  = "man"
 )
 
+// defaultTitle is used when the document has no heading to take a title from
+const defaultTitle = "Markdown Preview Tool"
+
+// config type packages the options that control rendering, which
+// prevents too many positional arguments as options are added
+type config struct {
+	// Alternate html/template file
+	tFname string
+	// Chroma style used to highlight fenced code blocks, empty disables it
+	theme string
+	// Add a table of contents at the top when there is no [TOC] marker
+	toc bool
+	// Deepest heading level in the table of contents, 0 includes all
+	tocDepth int
+	// Comma separated markdown extensions to add, or remove with a "-" prefix
+	extensions string
+	// Sanitizer profile: strict, ugc or trusted, empty means ugc
+	sanitize string
+	// File with a custom sanitizer allowlist, overrides sanitize
+	allowlist string
+	// Site navigation added to every page by build mode
+	nav template.HTML
+	// Inline local images and stylesheets into a single portable file
+	embed bool
+	// Size in bytes above which an embedded file gets a warning
+	embedWarn int64
+	// File the HTML is written to, "-" for stdout, empty for a temp file
+	outName string
+	// Output format: html, text or man, empty means html
+	format string
+	// Column plain text is wrapped at, 0 uses defaultWidth
+	width int
+	// Where warnings are written, os.Stderr when nil
+	errOut io.Writer
+}
+
+// content type holds the data available to templates
+//
+// # Attributes
+//
+// - Title (string): title of the document, its first heading by default
+//
+// - Body (template.HTML): sanitized HTML generated from the markdown
+//
+// - Meta (map[string]string): front matter fields other than the title,
+// rendered as meta tags by the default template
+//
+// - Style (template.CSS): stylesheet for highlighted code, empty if the
+// document has none
+//
+// - Nav (template.HTML): site navigation when building a directory,
+// empty for single files
+type content struct {
+	Title string
+	Body  template.HTML
+	Meta  map[string]string
+	Style template.CSS
+	Nav   template.HTML
+	// Body split into its top level blocks, for comparing documents
+	blocks []string
+}
+
 // Functions
 
-// main parses flags to determine which file to pass to run
+// main parses flags to determine which file to pass to run, or hands
+// the remaining arguments to a subcommand
 func main() {
+	// Subcommands have their own flags
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	// Override the default help/info message
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(),
@@ -44,47 +120,192 @@ func main() {
 			os.Args[0],
 		)
 		fmt.Fprintf(flag.CommandLine.Output(), "Adapted in October 2022\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Subcommands: %s\n", strings.Join(subcommandNames(), ", "))
 		fmt.Fprintln(flag.CommandLine.Output(), "Usage information:")
 		flag.PrintDefaults()
 	}
 	// Parse flags
-	filename := flag.String("file", "", "Markdown file to preview")
+	filename := flag.String("file", "", "Markdown file to preview, - or piped input reads stdin")
+	outName := flag.String("o", "", "Write the HTML to this file, - for stdout, instead of previewing a temp file")
 	skipPreview := flag.Bool("skipPreview", false, "Create HTML file without preview in browser")
+	renderConfig := addRenderFlags(flag.CommandLine)
+	serveFile := flag.Bool("serve", false, "Serve a live-reloading preview over HTTP instead of using a temp file")
+	addr := flag.String("addr", "localhost:8080", "Address the -serve preview listens on")
+	embed := flag.Bool("embed", false, "Inline local images and stylesheets into one portable HTML file")
+	embedWarn := flag.Int64("embed-warn", defaultEmbedWarn, "Warn when the -embed file is larger than this many bytes")
+	format := flag.String("format", formatHTML, "Output format: html, text for terminals, or man for a roff man page")
+	width := flag.Int("width", defaultWidth, "Column -format text wraps paragraphs at")
 	// help := flag.Bool("help", false, "Displays this message")
 	flag.Parse()
 
+	// Read piped input when no file is given
+	if *filename == "" && stdinPiped() {
+		*filename = stdio
+	}
 	if *filename == "" {
 		// If no flag is provided, pass a help message
 		flag.Usage()
 		os.Exit(1)
 	}
+	c := renderConfig()
+	c.embed = *embed
+	c.embedWarn = *embedWarn
+	c.outName = *outName
+	c.format = *format
+	c.width = *width
+
+	if *serveFile {
+		if c.format != formatHTML {
+			fmt.Fprintln(os.Stderr, "-serve previews HTML, it can't be used with -format", c.format)
+			os.Exit(1)
+		}
+		if *filename == stdio {
+			fmt.Fprintln(os.Stderr, "-serve needs a file to watch, not stdin")
+			os.Exit(1)
+		}
+		if err := serve(*filename, *addr, os.Stdout, c); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	if err := run(*filename, os.Stdout, *skipPreview); err != nil {
+	if err := run(*filename, os.Stdin, os.Stdout, *skipPreview, c); err != nil {
 		// Try to run the program without error
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// stdinPiped reports whether stdin is a pipe or file rather than a terminal
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// subcommands maps the first argument to the function running it, each
+// one parses the rest of the arguments with its own flag.FlagSet
+var subcommands = map[string]func(args []string, out io.Writer) error{
+	"build": buildCmd,
+	"check": checkCmd,
+	"diff":  diffCmd,
+	"lint":  lintCmd,
+}
+
+// subcommandNames returns the sorted names of the subcommands for the usage message
+func subcommandNames() []string {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// addRenderFlags registers the flags controlling rendering on fs, and
+// returns a function building the config once fs has been parsed
+//
+// This keeps the rendering flags the same for previews and subcommands
+func addRenderFlags(fs *flag.FlagSet) func() config {
+	tFname := fs.String("t", "", "Alternate html/template file, defaults to $MDP_TEMPLATE")
+	theme := fs.String("theme", "github", "Syntax highlighting theme for fenced code blocks, empty to disable")
+	toc := fs.Bool("toc", false, "Add a table of contents at the top, [TOC] in the file places it anywhere")
+	tocDepth := fs.Int("toc-depth", 3, "Deepest heading level included in the table of contents")
+	extensions := fs.String("ext", "", "Comma separated extensions to enable, prefix with - to disable: "+
+		strings.Join(extensionList(), ", "))
+	sanitize := fs.String("sanitize", profileUGC, "Sanitizer profile: strict, ugc, or trusted to skip sanitizing")
+	allowlist := fs.String("allowlist", "", "File listing allowed elements and attributes, overrides -sanitize")
+	return func() config {
+		// Fall back to the template from the environment
+		if *tFname == "" {
+			*tFname = os.Getenv("MDP_TEMPLATE")
+		}
+		return config{
+			tFname:     *tFname,
+			theme:      *theme,
+			toc:        *toc,
+			tocDepth:   *tocDepth,
+			extensions: *extensions,
+			sanitize:   *sanitize,
+			allowlist:  *allowlist,
+		}
+	}
+}
+
 // run coordinates the execution of the remaining functions
-func run(filename string, out io.Writer, skipPreview bool) error {
+//
+// The markdown is read from in when filename is "-", and the HTML is
+// written to out instead of a file when conf.outName is "-". Text and
+// man pages aren't previewed, so they go to out unless conf.outName is set
+func run(filename string, in io.Reader, out io.Writer, skipPreview bool, conf config) error {
 	// Parse the input file for any errors
-	input, err := os.ReadFile(filename)
+	var input []byte
+	var err error
+	baseDir := filepath.Dir(filename)
+	if filename == stdio {
+		input, err = io.ReadAll(in)
+		// Relative paths in piped markdown start at the working directory
+		baseDir = "."
+	} else {
+		input, err = os.ReadFile(filename)
+	}
 	if err != nil {
 		return err
 	}
 	// Convert the input to HTML data
-	htmlData := parseContent(input)
-	// Create a temporary file to prevent garbage
-	temp, err := os.CreateTemp("", "mdp*.html")
-	// Check for errors
+	htmlData, err := parseContent(input, conf)
 	if err != nil {
 		return err
 	}
-	if err := temp.Close(); err != nil {
+	if conf.format != "" && conf.format != formatHTML {
+		if conf.outName == "" {
+			conf.outName = stdio
+		}
+		return writeOutput(htmlData, out, conf.outName, true)
+	}
+	// Make the file portable if asked, relative paths start at the markdown file
+	if conf.embed {
+		errOut := conf.errOut
+		if errOut == nil {
+			errOut = os.Stderr
+		}
+		if htmlData, err = embedResources(htmlData, baseDir, errOut); err != nil {
+			return err
+		}
+		if conf.embedWarn > 0 && int64(len(htmlData)) > conf.embedWarn {
+			fmt.Fprintf(errOut, "warning: embedded file is %d bytes, larger than %d\n", len(htmlData), conf.embedWarn)
+		}
+	}
+	return writeOutput(htmlData, out, conf.outName, skipPreview)
+}
+
+// writeOutput writes the HTML to out when outName is "-", otherwise to
+// outName or a temporary file. Only the temporary file is opened in the
+// browser, unless skipPreview is set, since naming the output means it
+// is wanted on disk rather than on screen
+func writeOutput(htmlData []byte, out io.Writer, outName string, skipPreview bool) error {
+	// Writing to stdout lets mdp sit in a pipeline
+	if outName == stdio {
+		_, err := out.Write(htmlData)
 		return err
 	}
 
-	outName := temp.Name()
+	temporary := outName == ""
+	if temporary {
+		// Create a temporary file to prevent garbage
+		temp, err := os.CreateTemp("", "mdp*.html")
+		// Check for errors
+		if err != nil {
+			return err
+		}
+		if err := temp.Close(); err != nil {
+			return err
+		}
+		outName = temp.Name()
+	}
 
 	// Print the outName to stdout for clarity and testing
 	fmt.Fprintln(out, outName)
@@ -92,7 +313,7 @@ func run(filename string, out io.Writer, skipPreview bool) error {
 	if err := saveHTML(outName, htmlData); err != nil {
 		return err
 	}
-	if skipPreview {
+	if skipPreview || !temporary {
 		return nil
 	}
 
@@ -102,23 +323,213 @@ func run(filename string, out io.Writer, skipPreview bool) error {
 	return preview(outName)
 }
 
-// parseContent goes through the MD input and converts to HTML
+// parseContent goes through the MD input and converts to HTML, or to
+// plain text or a man page depending on conf.format
 //
-// The function takes in the MD file as an array of bytes and returns
-// the html data as an array of bytes
-func parseContent(input []byte) []byte {
-	// First we pass it through blackfriday to generate HTML
-	output := blackfriday.Run(input)
-	// Pass blackfriday output to bluemonday to santize output
-	body := bluemonday.UGCPolicy().SanitizeBytes(output)
+// The function takes in the MD file as an array of bytes and the
+// rendering options, and returns the html data as an array of bytes
+func parseContent(input []byte, conf config) ([]byte, error) {
+	switch conf.format {
+	case "", formatHTML:
+	case formatText:
+		return renderText(input, conf)
+	case formatMan:
+		return renderMan(input, conf)
+	default:
+		return nil, fmt.Errorf("unknown format %q, use %s, %s or %s", conf.format, formatHTML, formatText, formatMan)
+	}
+	c, err := renderMarkdown(input, conf)
+	if err != nil {
+		return nil, err
+	}
+	return executeTemplate(conf.tFname, c)
+}
+
+// renderMarkdown converts the MD input into the data given to templates,
+// with the sanitized HTML body, title and metadata
+func renderMarkdown(input []byte, conf config) (content, error) {
+	// First we pass it through blackfriday to generate an AST,
+	// so every heading can be given an anchor ID before rendering
+	fm, _, doc, taskLists, err := parseMarkdown(input, conf)
+	if err != nil {
+		return content{}, err
+	}
+	headings := addHeadingIDs(doc)
+	// Render the AST to HTML, highlighting code blocks if a theme is set
+	var renderer blackfriday.Renderer = blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+		Flags: blackfriday.CommonHTMLFlags,
+	})
+	var h *highlighter
+	if conf.theme != "" {
+		if h, err = newHighlighter(conf.theme); err != nil {
+			return content{}, err
+		}
+		renderer = h
+	}
+	blocks := renderASTBlocks(doc, renderer)
+	style := ""
+	if h != nil {
+		if style, err = h.css(); err != nil {
+			return content{}, err
+		}
+	}
+	// Pass blackfriday output to bluemonday to santize output,
+	// unless the docs are trusted
+	policy, err := sanitizer(conf.sanitize, conf.allowlist)
+	if err != nil {
+		return content{}, err
+	}
+	// Each block is sanitized on its own, so markup left open by raw
+	// HTML can't spill into the blocks after it
+	if policy != nil {
+		for idx, block := range blocks {
+			blocks[idx] = policy.Sanitize(block)
+		}
+	}
+	// Add the table of contents to the sanitized body
+	depth := conf.tocDepth
+	if depth <= 0 {
+		depth = 6
+	}
+	blocks = insertTOC(blocks, tocHTML(headings, depth), conf.toc)
+	if taskLists {
+		blocks = addTaskLists(blocks)
+	}
+	// Fill in the data available to the template
+	// The front matter title wins over the first heading
+	c := content{
+		Title:  documentTitle(fm, doc),
+		Body:   template.HTML(strings.Join(blocks, "")),
+		Meta:   fm.meta(),
+		Style:  template.CSS(style),
+		Nav:    conf.nav,
+		blocks: blocks,
+	}
+	return c, nil
+}
+
+// parseMarkdown strips any front matter from the MD input, so it isn't
+// rendered as markdown, and parses the rest with the extensions in conf
+//
+// It returns the front matter, the markdown body, its AST and whether
+// task lists are enabled
+func parseMarkdown(input []byte, conf config) (frontMatter, []byte, *blackfriday.Node, bool, error) {
+	fm, body, err := splitFrontMatter(input)
+	if err != nil {
+		return nil, nil, nil, false, err
+	}
+	ext, taskLists, err := parseExtensions(conf.extensions)
+	if err != nil {
+		return nil, nil, nil, false, err
+	}
+	doc := blackfriday.New(blackfriday.WithExtensions(ext)).Parse(body)
+	return fm, body, doc, taskLists, nil
+}
+
+// documentTitle returns the front matter title, or the first heading of
+// the body, or the default title
+func documentTitle(fm frontMatter, doc *blackfriday.Node) string {
+	if title := fm.title(); title != "" {
+		return title
+	}
+	if title := firstHeading(doc); title != "" {
+		return title
+	}
+	return defaultTitle
+}
+
+// executeTemplate renders c with the default template, or with the
+// template in tFname if it is set
+func executeTemplate(tFname string, c content) ([]byte, error) {
+	// Parse the default template, or the user's one if provided
+	t, err := template.New("mdp").Parse(defaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if tFname != "" {
+		t, err = template.ParseFiles(tFname)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// Create buffer to store the content
 	var buffer bytes.Buffer
-	// Write the html to the buffer
-	buffer.WriteString(header)
-	buffer.Write(body)
-	buffer.WriteString(footer)
+	// Execute the template into the buffer
+	if err := t.Execute(&buffer, c); err != nil {
+		return nil, err
+	}
 	// Return the generated HTML data
-	return buffer.Bytes()
+	return buffer.Bytes(), nil
+}
+
+// renderAST renders a parsed document the same way blackfriday.Run does
+func renderAST(doc *blackfriday.Node, renderer blackfriday.Renderer) []byte {
+	var buf bytes.Buffer
+	renderer.RenderHeader(&buf, doc)
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		return renderer.RenderNode(&buf, node, entering)
+	})
+	renderer.RenderFooter(&buf, doc)
+	return buf.Bytes()
+}
+
+// renderASTBlocks renders a parsed document like renderAST, returning
+// the output split where each top level block of the AST starts
+func renderASTBlocks(doc *blackfriday.Node, renderer blackfriday.Renderer) []string {
+	var buf bytes.Buffer
+	renderer.RenderHeader(&buf, doc)
+	var starts []int
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && node.Parent == doc {
+			starts = append(starts, buf.Len())
+		}
+		return renderer.RenderNode(&buf, node, entering)
+	})
+	renderer.RenderFooter(&buf, doc)
+	output := buf.String()
+	if len(starts) == 0 {
+		return []string{output}
+	}
+	// The header goes with the first block and the footer with the last
+	starts[0] = 0
+	blocks := make([]string, len(starts))
+	for idx, start := range starts {
+		end := len(output)
+		if idx+1 < len(starts) {
+			end = starts[idx+1]
+		}
+		blocks[idx] = output[start:end]
+	}
+	return blocks
+}
+
+// firstHeading returns the text of the first heading in the parsed
+// markdown, or an empty string if there is none
+//
+// It takes the AST the page is rendered from, so extensions such as
+// explicit heading IDs are handled the same way as in the body
+func firstHeading(doc *blackfriday.Node) string {
+	title := ""
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering || node.Type != blackfriday.Heading {
+			return blackfriday.GoToNext
+		}
+		title = nodeText(node)
+		return blackfriday.Terminate
+	})
+	return title
+}
+
+// nodeText concatenates the literal text of every node below node
+func nodeText(node *blackfriday.Node) string {
+	var b strings.Builder
+	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && (n.Type == blackfriday.Text || n.Type == blackfriday.Code) {
+			b.Write(n.Literal)
+		}
+		return blackfriday.GoToNext
+	})
+	return b.String()
 }
 
 // saveHTML saves the content created by parseContent into an html file
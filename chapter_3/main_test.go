@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -22,7 +23,10 @@ func TestParseContent(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	result := parseContent(input)
+	result, err := parseContent(input, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expected, err := os.ReadFile(goldenFile)
 	if err != nil {
@@ -36,12 +40,63 @@ func TestParseContent(t *testing.T) {
 	}
 }
 
+// TestParseContentTemplate checks a user template receives the title and body
+func TestParseContentTemplate(t *testing.T) {
+	input, err := os.ReadFile(inputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := parseContent(input, config{tFname: "./testdata/template.html.tmpl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile("./testdata/test1.md.template.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, result) {
+		t.Logf("Golden:\n%s\n", expected)
+		t.Logf("Result:\n%s\n", result)
+		t.Errorf("Result content does not match golden file")
+	}
+	// A missing template is an error rather than a silent fallback
+	if _, err := parseContent(input, config{tFname: "./testdata/missing.tmpl"}); err == nil {
+		t.Errorf("Expected error for missing template")
+	}
+}
+
+// TestFirstHeading checks the title is taken from the first heading
+func TestFirstHeading(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Heading", "# Title\n\n## Section\n", "Title"},
+		{"LaterHeading", "Some text\n\n## Section `code`\n", "Section code"},
+		{"Setext", "Title\n=====\n", "Title"},
+		{"NoHeading", "Just text\n", ""},
+		{"ExplicitID", "# Title {#custom}\n", "Title"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, doc, _, err := parseMarkdown([]byte(tc.input), config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title := firstHeading(doc); title != tc.expected {
+				t.Errorf("Expected %q, got %q instead", tc.expected, title)
+			}
+		})
+	}
+}
+
 // TestRun checks the bytes between result and golden
 func TestRun(t *testing.T) {
 	// Create a mock stdout pipe for testing
 	var mockStdOut bytes.Buffer
 
-	if err := run(inputFile, &mockStdOut, true); err != nil {
+	if err := run(inputFile, nil, &mockStdOut, true, config{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -66,12 +121,57 @@ func TestRun(t *testing.T) {
 	os.Remove(resultFile)
 }
 
+// TestRunStdio checks markdown can be piped in and HTML piped out
+func TestRunStdio(t *testing.T) {
+	input, err := os.ReadFile(inputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mockStdOut bytes.Buffer
+	if err := run("-", bytes.NewReader(input), &mockStdOut, true, config{outName: "-"}); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, mockStdOut.Bytes()) {
+		t.Logf("Golden:\n%s\n", expected)
+		t.Logf("Result:\n%s\n", mockStdOut.Bytes())
+		t.Errorf("Result content does not match golden file")
+	}
+}
+
+// TestRunOutputFile checks the HTML is written to the chosen file, which
+// isn't previewed even without skipPreview
+func TestRunOutputFile(t *testing.T) {
+	outName := filepath.Join(t.TempDir(), "out.html")
+	var mockStdOut bytes.Buffer
+	if err := run(inputFile, nil, &mockStdOut, false, config{outName: outName}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(mockStdOut.String()) != outName {
+		t.Errorf("Expected %q to be printed, got %q", outName, mockStdOut.String())
+	}
+	result, err := os.ReadFile(outName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, result) {
+		t.Errorf("Result content does not match golden file")
+	}
+}
+
 // TestShaHash checks the sha hash between result and golden
 func TestShaHash(t *testing.T) {
 	// Create a mock stdout pipe for testing
 	var mockStdOut bytes.Buffer
 
-	if err := run(inputFile, &mockStdOut, true); err != nil {
+	if err := run(inputFile, nil, &mockStdOut, true, config{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// defaultManSection is the man page section when the front matter has none
+const defaultManSection = "1"
+
+// roffEscaper escapes the characters roff treats specially inside text
+var roffEscaper = strings.NewReplacer(`\`, `\e`, "-", `\-`)
+
+// manRenderer type is a blackfriday.Renderer producing a roff man page
+type manRenderer struct {
+	// Name and section of the page for the .TH line
+	title   string
+	section string
+	// Date and manual name from the front matter, may be empty
+	date   string
+	manual string
+	// Whether the level 1 heading the title came from has been skipped
+	skippedTitle bool
+}
+
+// renderMan converts the MD input to a man page
+//
+// The front matter can set the section, date and manual of the page.
+// The title comes from the front matter or the first heading, which is
+// left out of the body as it is already the page header
+func renderMan(input []byte, conf config) ([]byte, error) {
+	fm, _, doc, _, err := parseMarkdown(input, conf)
+	if err != nil {
+		return nil, err
+	}
+	meta := fm.meta()
+	r := &manRenderer{
+		title:   documentTitle(fm, doc),
+		section: meta["section"],
+		date:    meta["date"],
+		manual:  meta["manual"],
+	}
+	if r.section == "" {
+		r.section = defaultManSection
+	}
+	return renderAST(doc, r), nil
+}
+
+// RenderHeader writes the .TH line naming the page
+func (r *manRenderer) RenderHeader(w io.Writer, ast *blackfriday.Node) {
+	fmt.Fprintf(w, ".TH %s %s %s \"\" %s\n",
+		roffQuote(strings.ToUpper(r.title)), roffQuote(r.section), roffQuote(r.date), roffQuote(r.manual))
+}
+
+// RenderFooter is part of blackfriday.Renderer, man pages have no footer
+func (r *manRenderer) RenderFooter(w io.Writer, ast *blackfriday.Node) {}
+
+// RenderNode writes the roff requests for each block, with the inline
+// content of paragraphs and headings written in one go
+func (r *manRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.Heading:
+		if node.Level == 1 && !r.skippedTitle && nodeText(node) == r.title {
+			r.skippedTitle = true
+			return blackfriday.SkipChildren
+		}
+		if node.Level <= 2 {
+			// Section headings are plain upper case text by convention
+			fmt.Fprintf(w, ".SH %s\n", roffQuote(strings.ToUpper(nodeText(node))))
+		} else {
+			fmt.Fprintf(w, ".SS %s\n", roffQuote(nodeText(node)))
+		}
+		return blackfriday.SkipChildren
+	case blackfriday.Paragraph:
+		// The first paragraph of a list item continues its .IP request
+		if node.Parent.Type != blackfriday.Item || node.Prev != nil {
+			fmt.Fprintln(w, ".PP")
+		}
+		fmt.Fprintln(w, roffLines(manInline(node)))
+		return blackfriday.SkipChildren
+	case blackfriday.CodeBlock:
+		fmt.Fprintln(w, ".PP\n.RS 4\n.nf")
+		fmt.Fprintln(w, roffLines(roffEscaper.Replace(strings.TrimSuffix(string(node.Literal), "\n"))))
+		fmt.Fprintln(w, ".fi\n.RE")
+	case blackfriday.List:
+		// Nested lists are indented under their item
+		if node.Parent != nil && node.Parent.Type == blackfriday.Item {
+			if entering {
+				fmt.Fprintln(w, ".RS")
+			} else {
+				fmt.Fprintln(w, ".RE")
+			}
+		}
+	case blackfriday.Item:
+		if !entering {
+			return blackfriday.GoToNext
+		}
+		if node.ListFlags&blackfriday.ListTypeOrdered != 0 {
+			fmt.Fprintf(w, ".IP %d. 4\n", itemNumber(node))
+		} else {
+			fmt.Fprintln(w, `.IP \(bu 2`)
+		}
+	case blackfriday.BlockQuote:
+		if entering {
+			fmt.Fprintln(w, ".RS")
+		} else {
+			fmt.Fprintln(w, ".RE")
+		}
+	case blackfriday.Table:
+		// Columns are padded with spaces in no-fill mode, tbl isn't assumed
+		fmt.Fprintln(w, ".PP\n.nf")
+		for _, line := range tableText(node) {
+			fmt.Fprintln(w, roffLines(roffEscaper.Replace(line)))
+		}
+		fmt.Fprintln(w, ".fi")
+		return blackfriday.SkipChildren
+	case blackfriday.HorizontalRule, blackfriday.HTMLBlock:
+		// Neither has a man page equivalent
+		return blackfriday.SkipChildren
+	}
+	return blackfriday.GoToNext
+}
+
+// manInline converts the inline nodes below a block to escaped roff
+// text, with bold and italic font changes
+func manInline(node *blackfriday.Node) string {
+	var b strings.Builder
+	for child := node.FirstChild; child != nil; child = child.Next {
+		switch child.Type {
+		case blackfriday.Text:
+			b.WriteString(roffEscaper.Replace(string(child.Literal)))
+		case blackfriday.Code:
+			b.WriteString(`\fB` + roffEscaper.Replace(string(child.Literal)) + `\fR`)
+		case blackfriday.Strong:
+			b.WriteString(`\fB` + manInline(child) + `\fR`)
+		case blackfriday.Emph:
+			b.WriteString(`\fI` + manInline(child) + `\fR`)
+		case blackfriday.Softbreak:
+			b.WriteString("\n")
+		case blackfriday.Hardbreak:
+			b.WriteString("\n.br\n")
+		case blackfriday.Link:
+			text, dest := manInline(child), string(child.LinkData.Destination)
+			b.WriteString(text)
+			if nodeText(child) != dest && "mailto:"+nodeText(child) != dest {
+				b.WriteString(" (" + roffEscaper.Replace(dest) + ")")
+			}
+		case blackfriday.Image:
+			b.WriteString("[image: " + manInline(child) + "]")
+		case blackfriday.HTMLSpan:
+			// Raw HTML has no man page equivalent
+		default:
+			b.WriteString(manInline(child))
+		}
+	}
+	return b.String()
+}
+
+// roffLines protects text lines starting with a period or apostrophe,
+// which roff would read as requests, leaving the requests added by the
+// renderer alone
+func roffLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for idx, line := range lines {
+		if line == ".br" {
+			continue
+		}
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[idx] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// roffQuote quotes an argument of a roff request
+func roffQuote(arg string) string {
+	return `"` + strings.ReplaceAll(roffEscaper.Replace(arg), `"`, `\(dq`) + `"`
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestRoffLines checks text lines roff would read as requests are escaped
+func TestRoffLines(t *testing.T) {
+	got := roffLines(".hidden\n'quoted\n.br\nplain")
+	expected := "\\&.hidden\n\\&'quoted\n.br\nplain"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+// TestManTitleHeading checks the heading used as the title isn't repeated
+// as a section, while later level 1 headings are
+func TestManTitleHeading(t *testing.T) {
+	result, err := parseContent([]byte("# tool\n\nText\n\n# tool\n"), config{format: formatMan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ".TH \"TOOL\" \"1\" \"\" \"\" \"\"\n.PP\nText\n.SH \"TOOL\"\n"
+	if string(result) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
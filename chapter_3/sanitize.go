@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Sanitizer profiles accepted by -sanitize
+const (
+	// profileStrict only allows the elements markdown itself produces
+	profileStrict = "strict"
+	// profileUGC is bluemonday's policy for user generated content
+	profileUGC = "ugc"
+	// profileTrusted skips sanitization, only for docs we wrote ourselves
+	profileTrusted = "trusted"
+)
+
+var (
+	// unsafeElements can run script or load other documents whatever
+	// their attributes, so allowlists can't allow them
+	unsafeElements = map[string]bool{
+		"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+		"object": true, "embed": true, "applet": true, "base": true, "meta": true, "link": true,
+	}
+	// unsafeAttrs can run script or inject markup on any element, as can
+	// every on* event handler
+	unsafeAttrs = map[string]bool{"srcdoc": true, "style": true, "formaction": true}
+)
+
+// sanitizer returns the policy for a profile, or the allowlist in
+// allowlist if it is set. A nil policy means the HTML isn't sanitized
+//
+// Every policy is extended to keep the markup mdp generates itself:
+// heading IDs and highlighted code classes
+func sanitizer(profile, allowlist string) (*bluemonday.Policy, error) {
+	var p *bluemonday.Policy
+	switch {
+	case allowlist != "":
+		var err error
+		if p, err = loadAllowlist(allowlist); err != nil {
+			return nil, err
+		}
+	case profile == "" || profile == profileUGC:
+		p = bluemonday.UGCPolicy()
+	case profile == profileStrict:
+		p = strictPolicy()
+	case profile == profileTrusted:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown sanitizer profile %q, use %s, %s or %s",
+			profile, profileStrict, profileUGC, profileTrusted)
+	}
+	return allowHeadingIDs(allowHighlighting(p)), nil
+}
+
+// strictPolicy allows the elements blackfriday renders from markdown,
+// without any of the raw HTML UGCPolicy tolerates
+func strictPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"ul", "ol", "li", "dl", "dt", "dd", "blockquote", "pre", "code",
+		"em", "strong", "del", "sup", "sub",
+		"table", "thead", "tbody", "tr", "th", "td")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowStandardURLs()
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
+
+// loadAllowlist builds a policy from a file listing one element per line,
+// followed by the attributes allowed on it:
+//
+//	# comments and blank lines are ignored
+//	p
+//	a href title
+//	img src alt
+//
+// Links are limited to the standard http, https and mailto URL schemes.
+// Elements and attributes that can run script, such as iframe, style or
+// on* event handlers, are refused
+func loadAllowlist(fname string) (*bluemonday.Policy, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		// These can never be safe, refuse them outright
+		if unsafeElements[strings.ToLower(fields[0])] {
+			return nil, fmt.Errorf("%s:%d: element %q can't be allowed", fname, line, fields[0])
+		}
+		for _, name := range fields[1:] {
+			name = strings.ToLower(name)
+			if strings.HasPrefix(name, "on") || unsafeAttrs[name] {
+				return nil, fmt.Errorf("%s:%d: attribute %q can't be allowed", fname, line, name)
+			}
+		}
+		p.AllowElements(fields[0])
+		if len(fields) > 1 {
+			p.AllowAttrs(fields[1:]...).OnElements(fields[0])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
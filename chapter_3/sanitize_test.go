@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// xssPayloads are markdown snippets trying to run script in the output
+var xssPayloads = []string{
+	"<script>alert(1)</script>",
+	"<img src=x onerror=alert(2)>",
+	"[click](javascript:alert(3))",
+	"<a href=\"javascript:alert(4)\">click</a>",
+	"<iframe src=\"https://example.com\"></iframe>",
+	"<svg onload=alert(5)></svg>",
+	"<p style=\"background:url(javascript:alert(6))\">x</p>",
+	"<input type=\"text\" onfocus=\"alert(7)\" autofocus>",
+}
+
+// xssMarkers must not appear in sanitized output
+var xssMarkers = []string{"<script", "onerror", "javascript:", "<iframe", "onload", "style=", "onfocus", "type=\"text\""}
+
+// TestSanitizeProfiles checks XSS payloads are stripped by every non-trusted profile
+func TestSanitizeProfiles(t *testing.T) {
+	testCases := []struct {
+		name string
+		conf config
+	}{
+		{"Default", config{}},
+		{"UGC", config{sanitize: profileUGC}},
+		{"Strict", config{sanitize: profileStrict}},
+		{"Allowlist", config{allowlist: "./testdata/allowlist.txt"}},
+		{"StrictTaskLists", config{sanitize: profileStrict, extensions: extTaskLists}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, payload := range xssPayloads {
+				result, err := parseContent([]byte("# Doc\n\n"+payload+"\n"), tc.conf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, marker := range xssMarkers {
+					if strings.Contains(string(result), marker) {
+						t.Errorf("Payload %q left %q in output:\n%s", payload, marker, result)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestSanitizeTrusted checks the trusted profile keeps raw HTML
+func TestSanitizeTrusted(t *testing.T) {
+	result, err := parseContent([]byte("<div class=\"note\" onclick=\"go()\">Hi</div>\n"), config{sanitize: profileTrusted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(result), `<div class="note" onclick="go()">Hi</div>`) {
+		t.Errorf("Expected raw HTML to be kept:\n%s", result)
+	}
+}
+
+// TestSanitizeStrict checks strict drops raw HTML UGC would keep
+func TestSanitizeStrict(t *testing.T) {
+	input := []byte("<details><summary>More</summary>Hidden</details>\n\n[link](https://example.com)\n")
+	result, err := parseContent(input, config{sanitize: profileStrict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(result), "<details>") {
+		t.Errorf("Expected details to be removed:\n%s", result)
+	}
+	if !strings.Contains(string(result), `<a href="https://example.com" rel="nofollow">link</a>`) {
+		t.Errorf("Expected markdown links to be kept:\n%s", result)
+	}
+}
+
+// TestSanitizeInput checks raw inputs are dropped by strict and allowlist
+// profiles, even when task lists add checkboxes of their own
+func TestSanitizeInput(t *testing.T) {
+	input := []byte("<p><input type=\"checkbox\" checked> raw</p>\n\n- [x] done\n")
+	testCases := []struct {
+		name string
+		conf config
+	}{
+		{"Strict", config{sanitize: profileStrict}},
+		{"Allowlist", config{allowlist: "./testdata/allowlist.txt"}},
+		{"StrictTaskLists", config{sanitize: profileStrict, extensions: extTaskLists}},
+		{"AllowlistTaskLists", config{allowlist: "./testdata/allowlist.txt", extensions: extTaskLists}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseContent(input, tc.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inputs := strings.Count(string(result), "<input")
+			expected := 0
+			if tc.conf.extensions == extTaskLists {
+				expected = 1
+			}
+			if inputs != expected || strings.Contains(string(result), "<input type=\"checkbox\" checked=\"\"> raw") {
+				t.Errorf("Expected %d generated input, got %d:\n%s", expected, inputs, result)
+			}
+		})
+	}
+}
+
+// TestSanitizeErrors checks unknown profiles and unsafe allowlists are refused
+func TestSanitizeErrors(t *testing.T) {
+	if _, err := sanitizer("lenient", ""); err == nil {
+		t.Errorf("Expected error for unknown profile")
+	}
+	if _, err := sanitizer("", "./testdata/missing.txt"); err == nil {
+		t.Errorf("Expected error for missing allowlist")
+	}
+	if _, err := sanitizer("", "./testdata/allowlist_unsafe.txt"); err == nil {
+		t.Errorf("Expected error for allowlist with an event handler")
+	}
+	for _, line := range []string{
+		"script", "iframe src", "object data", "embed src", "style", "link href",
+		"iframe srcdoc", "p style", "button formaction", "a href ONCLICK",
+	} {
+		fname := filepath.Join(t.TempDir(), "allowlist.txt")
+		if err := os.WriteFile(fname, []byte("p\n"+line+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sanitizer("", fname); err == nil {
+			t.Errorf("Expected error for allowlist line %q", line)
+		}
+	}
+}
+
+// TestExtensions checks extensions can be turned on and off
+func TestExtensions(t *testing.T) {
+	input := []byte("| a |\n|---|\n| 1 |\n\nNote[^1]\n\n[^1]: The note.\n\n- [ ] todo\n- [x] done\n- plain\n")
+	result, err := parseContent(input, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(result)
+	if !strings.Contains(html, "<table>") || strings.Contains(html, "footnote") || strings.Contains(html, "<input") {
+		t.Errorf("Expected only the common extensions by default:\n%s", html)
+	}
+
+	result, err = parseContent(input, config{extensions: "footnotes, tasklists, -tables"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html = string(result)
+	for _, expected := range []string{
+		`<li><input type="checkbox" disabled=""> todo</li>`,
+		`<li><input type="checkbox" checked="" disabled=""> done</li>`,
+		`<li>plain</li>`,
+		`The note.`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, html)
+		}
+	}
+	if strings.Contains(html, "<table>") || strings.Contains(html, "[^1]") {
+		t.Errorf("Expected tables off and footnotes on:\n%s", html)
+	}
+
+	if _, err := parseContent(input, config{extensions: "emoji"}); err == nil {
+		t.Errorf("Expected error for unknown extension")
+	}
+}
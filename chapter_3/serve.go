@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// reloadScript is injected into served pages so the browser reloads
+// whenever the server reports that the file changed
+const reloadScript = `<script>
+	new EventSource("/events").addEventListener("reload", function() { location.reload(); });
+</script>
+`
+
+// previewServer type renders a markdown file over HTTP and notifies
+// connected browsers over Server-Sent Events when the file changes
+//
+// This replaces the temp file preview when writing docs, so an edit
+// only needs a save instead of re-running the tool
+type previewServer struct {
+	// Markdown file being previewed
+	filename string
+	// Options used to render it
+	conf config
+	// Serves the images and other files the page links to, from the
+	// markdown file's directory and never above it
+	files http.Handler
+	// Guards the fields below
+	mu sync.Mutex
+	// Last seen modification time and size of the file
+	modTime time.Time
+	size    int64
+	// Channels of the browsers waiting for a reload event
+	clients map[chan struct{}]struct{}
+}
+
+// newPreviewServer creates a previewServer for filename and records the
+// current state of the file so only later edits trigger a reload
+func newPreviewServer(filename string, conf config) (*previewServer, error) {
+	s := &previewServer{
+		filename: filename,
+		conf:     conf,
+		files:    http.FileServer(http.Dir(filepath.Dir(filename))),
+		clients:  make(map[chan struct{}]struct{}),
+	}
+	if _, err := s.checkChanges(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ServeHTTP routes requests to the page, to the event stream, or to the
+// files next to the markdown file
+func (s *previewServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		s.page(w, r)
+	case "/events":
+		s.events(w, r)
+	default:
+		s.files.ServeHTTP(w, r)
+	}
+}
+
+// page renders the current version of the file with the reload script
+func (s *previewServer) page(w http.ResponseWriter, r *http.Request) {
+	input, err := os.ReadFile(s.filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	htmlData, err := parseContent(input, s.conf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Add the script right before the closing body tag
+	if idx := bytes.LastIndex(htmlData, []byte("</body>")); idx >= 0 {
+		htmlData = append(htmlData[:idx:idx], append([]byte(reloadScript), htmlData[idx:]...)...)
+	} else {
+		htmlData = append(htmlData, reloadScript...)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(htmlData)
+}
+
+// events keeps the connection open and sends a reload event each time
+// the file changes, until the browser disconnects
+func (s *previewServer) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ch := s.subscribe()
+	defer s.unsubscribe(ch)
+
+	// Send a comment so the client knows the stream is open
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			fmt.Fprint(w, "event: reload\ndata: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// subscribe registers a new browser to be notified of changes
+func (s *previewServer) subscribe() chan struct{} {
+	// Buffer a single event, a browser only needs to reload once
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.clients[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+// unsubscribe removes a browser that disconnected
+func (s *previewServer) unsubscribe(ch chan struct{}) {
+	s.mu.Lock()
+	delete(s.clients, ch)
+	s.mu.Unlock()
+}
+
+// checkChanges compares the file with its last seen state, notifying
+// every browser and returning true if it changed
+func (s *previewServer) checkChanges() (bool, error) {
+	info, err := os.Stat(s.filename)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return false, nil
+	}
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	for ch := range s.clients {
+		// Skip browsers that already have a reload pending
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return true, nil
+}
+
+// watch polls the file for changes every interval until done is closed
+//
+// Polling keeps the tool free of platform specific file notification APIs,
+// and a single file is cheap to stat
+func (s *previewServer) watch(interval time.Duration, out io.Writer, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			changed, err := s.checkChanges()
+			if err != nil {
+				// The file may be mid-save, try again on the next tick
+				fmt.Fprintln(out, err)
+				continue
+			}
+			if changed {
+				fmt.Fprintf(out, "%s changed, reloading\n", s.filename)
+			}
+		}
+	}
+}
+
+// serve starts the live-reload preview server for filename on addr
+func serve(filename, addr string, out io.Writer, conf config) error {
+	s, err := newPreviewServer(filename, conf)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go s.watch(500*time.Millisecond, out, done)
+
+	fmt.Fprintf(out, "Serving %s on http://%s\n", filename, addr)
+	return http.ListenAndServe(addr, s)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServePage checks the page is rendered with the reload script
+func TestServePage(t *testing.T) {
+	s, err := newPreviewServer(inputFile, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `<h1 id="test-1-markdown-file">Test 1 Markdown File</h1>`) {
+		t.Errorf("Expected rendered markdown in page, got:\n%s", body)
+	}
+	if !strings.Contains(string(body), reloadScript+"</body>") {
+		t.Errorf("Expected reload script before </body>, got:\n%s", body)
+	}
+}
+
+// TestServeFiles checks files next to the markdown file are served, and
+// nothing above its directory
+func TestServeFiles(t *testing.T) {
+	dir := t.TempDir()
+	doc := filepath.Join(dir, "docs")
+	if err := os.Mkdir(doc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(doc, "doc.md"):     "![dot](dot.png)\n",
+		filepath.Join(doc, "dot.png"):    "image",
+		filepath.Join(dir, "secret.txt"): "secret",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := newPreviewServer(filepath.Join(doc, "doc.md"), config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/dot.png", http.StatusOK, "image"},
+		{"/../secret.txt", http.StatusNotFound, ""},
+		{"/missing.png", http.StatusNotFound, ""},
+	}
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.status {
+			t.Errorf("Expected status %d for %s, got %d", tc.status, tc.path, rec.Code)
+		}
+		if tc.body != "" && rec.Body.String() != tc.body {
+			t.Errorf("Expected %q for %s, got %q", tc.body, tc.path, rec.Body.String())
+		}
+	}
+}
+
+// TestServeReload checks connected browsers get an event when the file changes
+func TestServeReload(t *testing.T) {
+	mdFile := filepath.Join(t.TempDir(), "doc.md")
+	if err := os.WriteFile(mdFile, []byte("# Before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newPreviewServer(mdFile, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %q", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+	// Wait for the stream to be open before changing the file
+	if line, err := r.ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("Expected connected comment, got %q, %v", line, err)
+	}
+
+	if changed, err := s.checkChanges(); err != nil || changed {
+		t.Fatalf("Expected no change yet, got %t, %v", changed, err)
+	}
+	if err := os.WriteFile(mdFile, []byte("# After the edit\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Move the modification time so the change is seen on coarse filesystems
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(mdFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := s.checkChanges(); err != nil || !changed {
+		t.Fatalf("Expected change to be detected, got %t, %v", changed, err)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "event: reload\n" {
+			break
+		}
+	}
+}
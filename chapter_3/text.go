@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// defaultWidth is the column plain text is wrapped at
+const defaultWidth = 80
+
+// textRenderer type is a blackfriday.Renderer producing plain text for
+// terminals, with reflowed paragraphs and underlined headings
+type textRenderer struct {
+	// Column paragraphs are wrapped at
+	width int
+	// Prefixes for each line of the current block, one per enclosing
+	// list item or quote
+	indent []string
+	// Replaces the innermost indent on the next line, for list markers
+	marker string
+	// Whether a blank line goes before the next block
+	blank bool
+}
+
+// renderText converts the MD input to plain text wrapped at conf.width
+func renderText(input []byte, conf config) ([]byte, error) {
+	_, _, doc, _, err := parseMarkdown(input, conf)
+	if err != nil {
+		return nil, err
+	}
+	width := conf.width
+	if width <= 0 {
+		width = defaultWidth
+	}
+	return renderAST(doc, &textRenderer{width: width}), nil
+}
+
+// RenderHeader is part of blackfriday.Renderer, plain text has no header
+func (r *textRenderer) RenderHeader(w io.Writer, ast *blackfriday.Node) {}
+
+// RenderFooter is part of blackfriday.Renderer, plain text has no footer
+func (r *textRenderer) RenderFooter(w io.Writer, ast *blackfriday.Node) {}
+
+// RenderNode writes each block once with its inline content flattened,
+// so the inline nodes below blocks are skipped
+func (r *textRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.Paragraph:
+		r.writeBlock(w, wrapText(inlineText(node), r.available()))
+		return blackfriday.SkipChildren
+	case blackfriday.Heading:
+		text := inlineText(node)
+		underline := "="
+		if node.Level > 1 {
+			underline = "-"
+		}
+		r.writeBlock(w, []string{text, strings.Repeat(underline, utf8.RuneCountInString(text))})
+		return blackfriday.SkipChildren
+	case blackfriday.CodeBlock:
+		lines := strings.Split(strings.TrimSuffix(string(node.Literal), "\n"), "\n")
+		for idx, line := range lines {
+			lines[idx] = "    " + line
+		}
+		r.writeBlock(w, lines)
+	case blackfriday.HorizontalRule:
+		r.writeBlock(w, []string{strings.Repeat("-", r.available())})
+	case blackfriday.Table:
+		r.writeBlock(w, tableText(node))
+		return blackfriday.SkipChildren
+	case blackfriday.HTMLBlock:
+		// Raw HTML has no plain text equivalent
+		return blackfriday.SkipChildren
+	case blackfriday.List:
+		// Nested tight lists follow their item's text without a gap
+		if entering && node.Tight && node.Parent != nil && node.Parent.Type == blackfriday.Item {
+			r.blank = false
+		}
+	case blackfriday.Item:
+		if !entering {
+			r.indent = r.indent[:len(r.indent)-1]
+			return blackfriday.GoToNext
+		}
+		if node.Parent.Tight && node.Prev != nil {
+			r.blank = false
+		}
+		r.marker = "* "
+		if node.ListFlags&blackfriday.ListTypeOrdered != 0 {
+			r.marker = fmt.Sprintf("%d. ", itemNumber(node))
+		}
+		r.indent = append(r.indent, strings.Repeat(" ", len(r.marker)))
+	case blackfriday.BlockQuote:
+		if entering {
+			r.indent = append(r.indent, "> ")
+		} else {
+			r.indent = r.indent[:len(r.indent)-1]
+		}
+	}
+	return blackfriday.GoToNext
+}
+
+// available returns the width left for text inside the current indent
+func (r *textRenderer) available() int {
+	width := r.width - len(strings.Join(r.indent, ""))
+	// Deeply nested blocks still get a usable width
+	if width < 20 {
+		width = 20
+	}
+	return width
+}
+
+// writeBlock writes the lines of a block with the current indent
+func (r *textRenderer) writeBlock(w io.Writer, lines []string) {
+	if r.blank {
+		fmt.Fprintln(w)
+	}
+	for idx, line := range lines {
+		prefix := strings.Join(r.indent, "")
+		if idx == 0 && r.marker != "" {
+			prefix = strings.Join(r.indent[:len(r.indent)-1], "") + r.marker
+			r.marker = ""
+		}
+		fmt.Fprintln(w, strings.TrimRight(prefix+line, " "))
+	}
+	r.blank = true
+}
+
+// itemNumber returns the number of an ordered list item
+func itemNumber(item *blackfriday.Node) int {
+	n := 1
+	for prev := item.Prev; prev != nil; prev = prev.Prev {
+		n++
+	}
+	return n
+}
+
+// inlineText flattens the inline nodes below a block into text, keeping
+// link destinations and image descriptions readable
+func inlineText(node *blackfriday.Node) string {
+	var b strings.Builder
+	for child := node.FirstChild; child != nil; child = child.Next {
+		switch child.Type {
+		case blackfriday.Text, blackfriday.Code:
+			// Line breaks in the source are reflowed like spaces
+			b.WriteString(strings.ReplaceAll(string(child.Literal), "\n", " "))
+		case blackfriday.Softbreak:
+			b.WriteString(" ")
+		case blackfriday.Hardbreak:
+			b.WriteString("\n")
+		case blackfriday.Link:
+			text, dest := inlineText(child), string(child.LinkData.Destination)
+			b.WriteString(text)
+			if text != dest && "mailto:"+text != dest {
+				b.WriteString(" (" + dest + ")")
+			}
+		case blackfriday.Image:
+			b.WriteString("[image: " + inlineText(child) + "]")
+		case blackfriday.HTMLSpan:
+			// Raw HTML has no plain text equivalent
+		default:
+			b.WriteString(inlineText(child))
+		}
+	}
+	return b.String()
+}
+
+// wrapText reflows text into lines no longer than width, except for
+// words longer than width, keeping hard line breaks
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width:
+				lines = append(lines, line)
+				line = word
+			default:
+				line += " " + word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// tableText lays a table out in columns padded to their widest cell
+func tableText(table *blackfriday.Node) []string {
+	var rows [][]string
+	header := 0
+	table.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering {
+			return blackfriday.GoToNext
+		}
+		switch node.Type {
+		case blackfriday.TableRow:
+			rows = append(rows, nil)
+			if node.Parent.Type == blackfriday.TableHead {
+				header = len(rows)
+			}
+		case blackfriday.TableCell:
+			rows[len(rows)-1] = append(rows[len(rows)-1], inlineText(node))
+			return blackfriday.SkipChildren
+		}
+		return blackfriday.GoToNext
+	})
+	var widths []int
+	for _, row := range rows {
+		for col, cell := range row {
+			if col == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[col] {
+				widths[col] = n
+			}
+		}
+	}
+	var lines []string
+	for idx, row := range rows {
+		cells := make([]string, len(row))
+		for col, cell := range row {
+			cells[col] = cell + strings.Repeat(" ", widths[col]-utf8.RuneCountInString(cell))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, "  "), " "))
+		if idx+1 == header {
+			rules := make([]string, len(widths))
+			for col, width := range widths {
+				rules[col] = strings.Repeat("-", width)
+			}
+			lines = append(lines, strings.Join(rules, "  "))
+		}
+	}
+	return lines
+}
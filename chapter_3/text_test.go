@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestParseContentFormats checks the text and man renderers against their golden files
+func TestParseContentFormats(t *testing.T) {
+	input, err := os.ReadFile("./testdata/formats.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name   string
+		conf   config
+		golden string
+	}{
+		{"Text", config{format: formatText, width: 40}, "./testdata/formats.md.txt"},
+		{"Man", config{format: formatMan}, "./testdata/formats.md.man"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseContent(input, tc.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := os.ReadFile(tc.golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, result) {
+				t.Logf("Golden:\n%s\n", expected)
+				t.Logf("Result:\n%s\n", result)
+				t.Errorf("Result content does not match golden file")
+			}
+		})
+	}
+}
+
+// TestParseContentUnknownFormat checks an unknown format is an error
+func TestParseContentUnknownFormat(t *testing.T) {
+	if _, err := parseContent([]byte("# Title\n"), config{format: "pdf"}); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
+
+// TestRunText checks text output goes to stdout instead of a previewed temp file
+func TestRunText(t *testing.T) {
+	var mockStdOut bytes.Buffer
+	conf := config{format: formatText}
+	if err := run(inputFile, nil, &mockStdOut, false, conf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Test 1 Markdown File\n====================\n"
+	if !bytes.HasPrefix(mockStdOut.Bytes(), []byte(expected)) {
+		t.Errorf("Expected output starting with %q, got:\n%s", expected, mockStdOut.String())
+	}
+}
+
+// TestWrapText checks paragraphs are reflowed and long words kept whole
+func TestWrapText(t *testing.T) {
+	lines := wrapText("one two three https://example.com/a/long/path four\nfive", 10)
+	expected := []string{"one two", "three", "https://example.com/a/long/path", "four", "five"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %q, got %q", expected, lines)
+	}
+	for idx := range expected {
+		if lines[idx] != expected[idx] {
+			t.Errorf("Expected %q, got %q", expected, lines)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// tocMarker is the paragraph blackfriday renders for a [TOC] line
+const tocMarker = "<p>[TOC]</p>"
+
+// headingID matches the anchor IDs generated by slugify, which may
+// contain any letter or number unlike the ASCII-only IDs UGCPolicy allows
+var headingID = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+
+// heading type describes a heading for the table of contents
+type heading struct {
+	level int
+	text  string
+	id    string
+}
+
+// slugify turns heading text into an anchor ID the same way GitHub does:
+// lowercase, drop punctuation, and replace spaces with hyphens
+func slugify(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// addHeadingIDs gives every heading in the document a unique anchor ID,
+// keeping IDs set explicitly with {#id}, and returns the headings in order
+//
+// Duplicate IDs get a -1, -2, ... suffix so links to the first heading
+// keep working when another one with the same text is added later.
+// Generated IDs never take an explicit ID used further down, and explicit
+// IDs that aren't valid anchors are replaced by generated ones
+func addHeadingIDs(doc *blackfriday.Node) []heading {
+	var headings []heading
+	explicit := map[string]bool{}
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && node.Type == blackfriday.Heading && !node.IsTitleblock {
+			if headingID.MatchString(node.HeadingID) {
+				explicit[node.HeadingID] = true
+			} else {
+				node.HeadingID = ""
+			}
+		}
+		return blackfriday.GoToNext
+	})
+	seen := map[string]bool{}
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering || node.Type != blackfriday.Heading || node.IsTitleblock {
+			return blackfriday.GoToNext
+		}
+		text := nodeText(node)
+		id := node.HeadingID
+		generated := id == ""
+		if generated {
+			id = slugify(text)
+		}
+		base := id
+		for n := 1; seen[id] || (generated && explicit[id]); n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		node.HeadingID = id
+		seen[id] = true
+		headings = append(headings, heading{level: node.Level, text: text, id: id})
+		return blackfriday.GoToNext
+	})
+	return headings
+}
+
+// tocHTML builds a nested list of links to the headings, skipping
+// headings deeper than maxDepth
+//
+// Nesting is relative to the shallowest heading, so a document that
+// starts at h2 doesn't get an empty outer level
+func tocHTML(headings []heading, maxDepth int) string {
+	var included []heading
+	minLevel := 0
+	for _, h := range headings {
+		if h.level > maxDepth {
+			continue
+		}
+		included = append(included, h)
+		if minLevel == 0 || h.level < minLevel {
+			minLevel = h.level
+		}
+	}
+	if len(included) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("<nav class=\"toc\">\n")
+	depth := 0
+	for idx, h := range included {
+		level := h.level - minLevel + 1
+		// Keep the previous item open if this heading nests below it
+		if idx > 0 {
+			if level > depth {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("</li>\n")
+			}
+		}
+		for depth < level {
+			b.WriteString("<ul>\n")
+			depth++
+			// Skipped heading levels get an empty item to nest in
+			if depth < level {
+				b.WriteString("<li>\n")
+			}
+		}
+		for depth > level {
+			b.WriteString("</ul>\n</li>\n")
+			depth--
+		}
+		fmt.Fprintf(&b, "<li><a href=\"#%s\">%s</a>", html.EscapeString(h.id), html.EscapeString(h.text))
+	}
+	b.WriteString("</li>\n")
+	for depth > 0 {
+		b.WriteString("</ul>\n")
+		depth--
+		if depth > 0 {
+			b.WriteString("</li>\n")
+		}
+	}
+	b.WriteString("</nav>\n")
+	return b.String()
+}
+
+// insertTOC replaces the [TOC] marker in the blocks of a body with the
+// table of contents, or adds it as the first block when there is no
+// marker and atTop is set
+//
+// It runs after sanitization, since the policy doesn't allow nav and the
+// table of contents is generated from escaped text and safe IDs
+func insertTOC(blocks []string, toc string, atTop bool) []string {
+	found := false
+	for idx, block := range blocks {
+		if strings.Contains(block, tocMarker) {
+			blocks[idx] = strings.Replace(block, tocMarker, strings.TrimSuffix(toc, "\n"), -1)
+			found = true
+		}
+	}
+	if !found && atTop {
+		return append([]string{toc + "\n"}, blocks...)
+	}
+	return blocks
+}
+
+// allowHeadingIDs extends a sanitizer policy to keep the generated
+// heading anchor IDs
+func allowHeadingIDs(p *bluemonday.Policy) *bluemonday.Policy {
+	p.AllowAttrs("id").Matching(headingID).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	return p
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSlugify checks anchor IDs match the ones GitHub generates
+func TestSlugify(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"API v2.0", "api-v20"},
+		{"snake_case and-dash", "snake_case-and-dash"},
+		{"Überblick & Details", "überblick--details"},
+		{"  Spaced  ", "--spaced--"},
+	}
+	for _, tc := range testCases {
+		if slug := slugify(tc.input); slug != tc.expected {
+			t.Errorf("slugify(%q): expected %q, got %q instead", tc.input, tc.expected, slug)
+		}
+	}
+}
+
+// TestParseContentTOC checks the [TOC] marker is replaced and IDs survive sanitization
+func TestParseContentTOC(t *testing.T) {
+	input, err := os.ReadFile("./testdata/toc.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := parseContent(input, config{tocDepth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile("./testdata/toc.md.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, result) {
+		t.Logf("Golden:\n%s\n", expected)
+		t.Logf("Result:\n%s\n", result)
+		t.Errorf("Result content does not match golden file")
+	}
+}
+
+// TestParseContentTOCFlag checks the toc option adds a table of contents without a marker
+func TestParseContentTOCFlag(t *testing.T) {
+	input := []byte("# One\n\n## Two\n")
+	result, err := parseContent(input, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(result), "<nav") {
+		t.Errorf("Expected no table of contents by default:\n%s", result)
+	}
+	result, err = parseContent(input, config{toc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<nav class=\"toc\">\n<ul>\n<li><a href=\"#one\">One</a>\n<ul>\n<li><a href=\"#two\">Two</a></li>\n</ul>\n</li>\n</ul>\n</nav>\n\n<h1 id=\"one\">One</h1>"
+	if !strings.Contains(string(result), expected) {
+		t.Errorf("Expected table of contents at the top:\n%s", result)
+	}
+}
+
+// TestTOCEscaped checks heading text can't inject markup into the table of contents
+func TestTOCEscaped(t *testing.T) {
+	result, err := parseContent([]byte("# A <b onclick=\"x\">bold</b> move\n"), config{toc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(result), "onclick") {
+		t.Errorf("Expected markup in headings to be removed:\n%s", result)
+	}
+}
+
+// TestTOCExplicitIDs checks explicit IDs can't inject markup and never
+// clash with other IDs on the page
+func TestTOCExplicitIDs(t *testing.T) {
+	input := "# T {#x\"><img src=x onerror=alert(1)>}\n\n## Intro\n\n## Other {#intro}\n\n## Again {#intro}\n"
+	result, err := parseContent([]byte(input), config{toc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(result), "onerror") || strings.Contains(string(result), "<img") {
+		t.Errorf("Expected the invalid ID to be dropped:\n%s", result)
+	}
+	for _, id := range []string{"t", "intro-1", "intro", "intro-2"} {
+		if n := strings.Count(string(result), "id=\""+id+"\""); n != 1 {
+			t.Errorf("Expected one heading with ID %q, got %d:\n%s", id, n, result)
+		}
+		if !strings.Contains(string(result), "href=\"#"+id+"\"") {
+			t.Errorf("Expected a link to %q in the table of contents:\n%s", id, result)
+		}
+	}
+}
@@ -3,36 +3,109 @@ package main
 import (
 	"fmt"
 	"io"
+	"log"
 	"os"
-	"path/filepath"
-	"strings"
 )
 
-// filterOut evaluates some metadata about the file or directory
-// identified by the path walking process
-func filterOut(path, ext string, minSize int64, info os.FileInfo) bool {
-	if info.IsDir() || info.Size() < minSize {
-		// Filter out file if its a directory or less than the min size
-		return true
-	}
-	if ext != "" && filepath.Ext(path) != ext {
-		// Filter out file if the extension is nul not what we want
-		return true
-	}
-	return false
-}
-
 // listFile prints the path of the current file to the specified out pipe
 func listFile(path string, out io.Writer) error {
 	_, err := fmt.Fprintln(out, path)
 	return err
 }
 
-func delFile(path string) error {
-	splitPath := strings.Split(path, "/")
-	if splitPath[0] == "tmp" || (splitPath[0] == "." && splitPath[1] == "tmp") {
-		return os.Remove(path)
-	} else {
-		return fmt.Errorf("cannot delete non-temp files: %s", path)
+// delFile removes the file at path if the policy allows it
+func delFile(path string, policy deletePolicy) error {
+	if err := policy.check(path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// deleter type carries out -del for every matched file, keeping the
+// totals for -dry-run and the trash can across the walk
+type deleter struct {
+	policy deletePolicy
+	// Print what would be deleted instead of deleting it
+	dryRun bool
+	// Move files here instead of deleting them, nil deletes for good
+	trash *trashCan
+	// Audit log of what was done, may be nil
+	logger *log.Logger
+	out    io.Writer
+	// Number and total size of the files handled so far
+	count int
+	size  int64
+}
+
+// newDeleter returns the deleter for the delete options in conf
+func newDeleter(conf config, out io.Writer) *deleter {
+	d := &deleter{policy: conf.policy, dryRun: conf.dryRun, logger: conf.logger, out: out}
+	if conf.trash != "" {
+		d.trash = &trashCan{root: conf.trash}
+	}
+	return d
+}
+
+// remove deletes or trashes the file at path, or only reports it in a
+// dry run. The policy is checked in every mode
+func (d *deleter) remove(path string) error {
+	if err := d.policy.check(path); err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case d.dryRun:
+		fmt.Fprintf(d.out, "would delete %s (%d bytes)\n", path, info.Size())
+	case d.trash != nil:
+		trashed, err := d.trash.put(path, info.Size())
+		if err != nil {
+			return err
+		}
+		logf(d.logger, "trashed %s to %s", path, trashed)
+	default:
+		if err := delFile(path, d.policy); err != nil {
+			return err
+		}
+		logf(d.logger, "deleted %s (%d bytes)", path, info.Size())
+	}
+	d.count++
+	d.size += info.Size()
+	return nil
+}
+
+// finish closes the trash manifest and prints the dry run totals
+func (d *deleter) finish() error {
+	if d.trash != nil {
+		if err := d.trash.close(); err != nil {
+			return err
+		}
+	}
+	if d.dryRun {
+		_, err := fmt.Fprintf(d.out, "would reclaim %d bytes from %d files\n", d.size, d.count)
+		return err
+	}
+	return nil
+}
+
+// openLog returns a logger writing timestamped lines to the file name,
+// or a nil logger if name is empty, and a function closing the file
+func openLog(name string) (*log.Logger, func() error, error) {
+	if name == "" {
+		return nil, func() error { return nil }, nil
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return log.New(f, "", log.LstdFlags), f.Close, nil
+}
+
+// logf writes to the audit log if there is one
+func logf(logger *log.Logger, format string, v ...interface{}) {
+	if logger != nil {
+		logger.Printf(format, v...)
 	}
 }
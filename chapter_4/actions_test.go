@@ -1,103 +1,82 @@
 package main
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 )
 
-func TestFilterOut(t *testing.T) {
+func TestDelete(t *testing.T) {
+	// Lay out an allowed root next to directories it must not reach
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := filepath.Join(base, "allowed")
+	for _, dir := range []string{"allowed/sub", "allowed2", "outside", "allowed/keep"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"allowed/sub/file", "allowed2/file", "outside/file", "allowed/keep/file"} {
+		if err := os.WriteFile(filepath.Join(base, f), []byte("dummy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A directory symlink leading out of the allowed root, and a file
+	// symlink whose target must survive the link being deleted
+	if err := os.Symlink(filepath.Join(base, "outside"), filepath.Join(allowed, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "outside", "file"), filepath.Join(allowed, "link")); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := newDeletePolicy([]string{allowed}, []string{filepath.Join(allowed, "keep")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// Create anonymous slice of struct with test case definitions
 	testCases := []struct {
-		// Here we define the properties of our tests
 		name     string
-		file     string
-		ext      string
-		minSize  int64
-		expected bool
+		path     string
+		expected error
 	}{
-		// Here we define each test
-		{"FilterNoExtension", "testdata/dir.log", "", 0, false},
-		{"FilterExtensionMatch", "testdata/dir.log", ".log", 0, false},
-		{"FilterExtensionNoMatch", "testdata/dir.log", ".sh", 0, true},
-		{"FilterExtensionSizeMatch", "testdata/dir.log", ".log", 10, false},
-		{"FilterExtensionSizeNoMatch", "testdata/dir.log", ".log", 20, true},
+		{"DeleteAllowed", filepath.Join(allowed, "sub", "file"), nil},
+		{"DeleteSymlinkNotTarget", filepath.Join(allowed, "link"), nil},
+		{"DeleteTraversal", filepath.Join(allowed, "sub", "..", "..", "outside", "file"), errNotAllowed},
+		{"DeleteSiblingPrefix", filepath.Join(base, "allowed2", "file"), errNotAllowed},
+		{"DeleteSymlinkEscape", filepath.Join(allowed, "escape", "file"), errNotAllowed},
+		{"DeleteRoot", allowed, errNotAllowed},
+		{"DeleteProtected", filepath.Join(allowed, "keep", "file"), errProtected},
+		{"DeleteSystem", "/etc/passwd", errProtected},
+		{"DeleteRelative", "testdata/dir.log", errNotAllowed},
 	}
 	// Iterate over the testCases object and run the test
 	for _, tc := range testCases {
-		// Run a test
 		t.Run(tc.name, func(t *testing.T) {
-			// Get the file's attributes using Stat
-			info, err := os.Stat(tc.file)
-			if err != nil {
-				// Check for errors
-				t.Fatal(err)
+			err := delFile(tc.path, policy)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("Expected:\n\t%v\nGot:\n\t%v", tc.expected, err)
 			}
-
-			// Run filterOut for the specified inputs
-			filterResult := filterOut(tc.file, tc.ext, tc.minSize, info)
-
-			// Check that the result was what we expected
-			if filterResult != tc.expected {
-				t.Errorf("Expected:\n\t%t\nGot:\n\t%t", tc.expected, filterResult)
+			_, statErr := os.Lstat(tc.path)
+			if tc.expected == nil && !os.IsNotExist(statErr) {
+				t.Errorf("Expected %s to be deleted", tc.path)
+			}
+			if tc.expected != nil && statErr != nil {
+				t.Errorf("Expected %s to be kept: %s", tc.path, statErr)
 			}
 		})
 	}
-}
-
-func TestDelete(t *testing.T) {
-	// Create anonymous slice of struct with test case definitions
-	testCases := []struct {
-		// Here we define the properties of our tests
-		name          string
-		path          string
-		createTempDir bool
-		expected      string
-	}{
-		// Here we define each test
-		{"DeleteNonTempDir", "testdata/dir2", false, fmt.Errorf("cannot delete non-temp files: %s", "testdata/dir2").Error()},
-		// {"DeleteTempDir", "testdata", true, ""},
-		// {"FilterExtensionNoMatch", "testdata/dir.log", ".sh", 0, true},
-		// {"FilterExtensionSizeMatch", "testdata/dir.log", ".log", 10, false},
-		// {"FilterExtensionSizeNoMatch", "testdata/dir.log", ".log", 20, true},
+	// Deleting the link must leave its target alone
+	if _, err := os.Stat(filepath.Join(base, "outside", "file")); err != nil {
+		t.Errorf("Expected the symlink target to be kept: %s", err)
 	}
-	// Iterate over the testCases object and run the test
-	for _, tc := range testCases {
-		// Run a test
-		t.Run(tc.name, func(t *testing.T) {
-			if tc.createTempDir {
-				// Create temp dir
-				tempDir, err := os.MkdirTemp("./tmp", tc.path)
-				if err != nil {
-					t.Fatal(err)
-				}
-				for i := 0; i < 5; i++ {
-					fname := fmt.Sprintf("file%d", i)
-					fpath := filepath.Join(tempDir, fname)
-					if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
-						t.Fatal(err)
-					}
-					// Try to delete dir
-					deleteResult := delFile(fpath).Error()
-
-					// Check that the result was what we expected
-					if deleteResult != tc.expected {
-						t.Errorf("Expected:\n\t%s\nGot:\n\t%s", tc.expected, deleteResult)
-					}
-					// Cleanup
-				}
-				os.RemoveAll(tempDir)
-			} else {
-				// Try and delete the given file
-				deleteResult := delFile(tc.path).Error()
-
-				// Check that the result was what we expected
-				if deleteResult != tc.expected {
-					t.Errorf("Expected:\n\t%s\nGot:\n\t%s", tc.expected, deleteResult)
-				}
-			}
+}
 
-		})
+func TestDeletePolicyRelativeRoot(t *testing.T) {
+	if _, err := newDeletePolicy([]string{"tmp"}, nil); err == nil {
+		t.Errorf("Expected an error for a relative allowed root")
 	}
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveFiles compresses files into dir, keeping their path relative to
+// root, and checks what was written can be read back before returning
+//
+// Each file becomes its own .gz file, unless tarball is set, which puts
+// them all in one .tar.gz. It returns the paths of the archives written
+func archiveFiles(dir, root string, files []string, tarball bool) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if tarball {
+		base := filepath.Join(dir, fmt.Sprintf("%s-%s",
+			filepath.Base(filepath.Clean(root)), time.Now().Format("20060102-150405")))
+		name, sums, err := tarFiles(base, root, files)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyTar(name, sums); err != nil {
+			return nil, err
+		}
+		return []string{name}, nil
+	}
+	var archives []string
+	for _, f := range files {
+		name, sum, err := gzipFile(dir, root, f)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyGzip(name, sum); err != nil {
+			return nil, err
+		}
+		archives = append(archives, name)
+	}
+	return archives, nil
+}
+
+// relName returns the slash separated path of file relative to root,
+// used as its name inside archives
+func relName(root, file string) (string, error) {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// createArchive creates a new archive named base plus ext, adding a
+// .1, .2, ... suffix to base if an earlier run already wrote that name
+//
+// Archives are never overwritten, as the files in an earlier one may
+// have been deleted since
+func createArchive(base, ext string) (*os.File, error) {
+	name := base + ext
+	for n := 1; ; n++ {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+		name = fmt.Sprintf("%s.%d%s", base, n, ext)
+	}
+}
+
+// gzipFile compresses file into dir under its path relative to root,
+// returning the archive name and the SHA-256 of the original content
+func gzipFile(dir, root, file string) (string, []byte, error) {
+	rel, err := relName(root, file)
+	if err != nil {
+		return "", nil, err
+	}
+	base := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return "", nil, err
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := createArchive(base, ".gz")
+	if err != nil {
+		return "", nil, err
+	}
+	defer out.Close()
+	name := out.Name()
+
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(file)
+	zw.ModTime = info.ModTime()
+	h := sha256.New()
+	if _, err := io.Copy(zw, io.TeeReader(in, h)); err != nil {
+		return "", nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return "", nil, err
+	}
+	return name, h.Sum(nil), out.Close()
+}
+
+// verifyGzip decompresses the archive, which also checks its CRC, and
+// compares the content with the original file's SHA-256
+func verifyGzip(name string, sum []byte) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("archive %s is corrupt: %w", name, err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, zr); err != nil {
+		return fmt.Errorf("archive %s is corrupt: %w", name, err)
+	}
+	if !bytes.Equal(h.Sum(nil), sum) {
+		return fmt.Errorf("archive %s doesn't match the original file", name)
+	}
+	return zr.Close()
+}
+
+// tarFiles writes every file into a single new tar.gz named after base,
+// returning its name and the SHA-256 of each file's content by its name
+// in the archive
+func tarFiles(base, root string, files []string) (string, map[string][]byte, error) {
+	out, err := createArchive(base, ".tar.gz")
+	if err != nil {
+		return "", nil, err
+	}
+	defer out.Close()
+	name := out.Name()
+	zw := gzip.NewWriter(out)
+	tw := tar.NewWriter(zw)
+
+	sums := map[string][]byte{}
+	for _, file := range files {
+		rel, err := relName(root, file)
+		if err != nil {
+			return "", nil, err
+		}
+		if sums[rel], err = addToTar(tw, file, rel); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return "", nil, err
+	}
+	return name, sums, out.Close()
+}
+
+// addToTar writes one file into tw as rel, returning its SHA-256
+func addToTar(tw *tar.Writer, file, rel string) ([]byte, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	// Stat the open file, so symlinks are archived as their content
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = rel
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(tw, io.TeeReader(in, h)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// verifyTar reads the whole archive back and checks it holds exactly
+// the files in sums with the same content
+func verifyTar(name string, sums map[string][]byte) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("archive %s is corrupt: %w", name, err)
+	}
+	tr := tar.NewReader(zr)
+	seen := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive %s is corrupt: %w", name, err)
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return fmt.Errorf("archive %s is corrupt: %w", name, err)
+		}
+		if sum, ok := sums[hdr.Name]; !ok || !bytes.Equal(h.Sum(nil), sum) {
+			return fmt.Errorf("archive %s: %s doesn't match the original file", name, hdr.Name)
+		}
+		seen++
+	}
+	if seen != len(sums) {
+		return fmt.Errorf("archive %s has %d files, expected %d", name, seen, len(sums))
+	}
+	return zr.Close()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunArchive(t *testing.T) {
+	root := createTree(t, []string{"a.log", "sub/b.log", "c.txt"})
+	dir := filepath.Join(t.TempDir(), "archive")
+	var buffer bytes.Buffer
+	conf := config{ext: []string{".log"}, archive: dir}
+	if err := run(root, &buffer, conf); err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(root, "a.log") + "\n" + filepath.Join(root, "sub", "b.log") + "\n"
+	if buffer.String() != expected {
+		t.Errorf("Expected:\n\t%q\nGot:\n\t%q", expected, buffer.String())
+	}
+	for _, name := range []string{"a.log.gz", "sub/b.log.gz"} {
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "dummy" {
+			t.Errorf("Expected %s to hold %q, got %q", name, "dummy", data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c.txt.gz")); !os.IsNotExist(err) {
+		t.Errorf("Expected c.txt not to be archived")
+	}
+}
+
+func TestRunArchiveTar(t *testing.T) {
+	root := createTree(t, []string{"a.log", "sub/b.log"})
+	// The archive is below the root, and mustn't be archived itself
+	dir := filepath.Join(root, "archive")
+	conf := config{archive: dir, tarball: true}
+	if err := run(root, io.Discard, conf); err != nil {
+		t.Fatal(err)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tar.gz"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("Expected one tar.gz in %s, got %v %v", dir, matches, err)
+	}
+	f, err := os.Open(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 2 || names[0] != "a.log" || names[1] != "sub/b.log" {
+		t.Errorf("Expected [a.log sub/b.log] in the archive, got %q", names)
+	}
+}
+
+func TestVerifyCorruptArchive(t *testing.T) {
+	root := createTree(t, []string{"a.log"})
+	dir := t.TempDir()
+	name, sum, err := gzipFile(dir, root, filepath.Join(root, "a.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyGzip(name, sum); err != nil {
+		t.Fatalf("Expected a good archive, got %s", err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a byte of the CRC in the gzip trailer
+	data[len(data)-5] ^= 0xff
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyGzip(name, sum); err == nil {
+		t.Errorf("Expected an error for a corrupt archive")
+	}
+
+	tarName, sums, err := tarFiles(filepath.Join(dir, "files"), root, []string{filepath.Join(root, "a.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums["missing.log"] = sum
+	if err := verifyTar(tarName, sums); err == nil {
+		t.Errorf("Expected an error for a file missing from the archive")
+	}
+}
+
+func TestRunArchiveTwice(t *testing.T) {
+	root := createTree(t, []string{"a.log"})
+	dir := t.TempDir()
+	for _, data := range []string{"first", "second"} {
+		if err := os.WriteFile(filepath.Join(root, "a.log"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := run(root, io.Discard, config{archive: dir}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The second run mustn't overwrite the first archive
+	for name, expected := range map[string]string{"a.log.gz": "first", "a.log.1.gz": "second"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %s to hold %q, got %q", name, expected, data)
+		}
+	}
+}
+
+func TestRunArchiveFailureKeepsFiles(t *testing.T) {
+	root := createTree(t, []string{"a.log"})
+	// A file where the archive directory should be makes archiving fail
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config{archive: filepath.Join(blocker, "archive"), del: true}
+	if err := run(root, io.Discard, conf); err == nil {
+		t.Fatal("Expected an error when the archive can't be written")
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.log")); err != nil {
+		t.Errorf("Expected a.log to be kept when archiving fails: %s", err)
+	}
+}
+
+func TestRunArchiveDelete(t *testing.T) {
+	root := createTree(t, []string{"a.log", "b.txt"})
+	policy, err := newDeletePolicy([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "archive")
+	conf := config{ext: []string{".log"}, archive: dir, del: true, policy: policy}
+	if err := run(root, io.Discard, conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.log.gz")); err != nil {
+		t.Errorf("Expected a.log to be archived: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected a.log to be deleted once archived")
+	}
+	if _, err := os.Stat(filepath.Join(root, "b.txt")); err != nil {
+		t.Errorf("Expected b.txt to be kept: %s", err)
+	}
+}
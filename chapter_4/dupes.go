@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// partialSize is how much of the start and end of a file the partial
+// hash reads, telling most same sized files apart cheaply
+const partialSize = 4096
+
+// dupeFile type is one file of a set of duplicates
+type dupeFile struct {
+	entry
+	// Other paths found that are hard links to the same file
+	links []string
+}
+
+// dupeSet type is a group of files with identical content, oldest first
+type dupeSet []dupeFile
+
+// wasted returns the space taken by every copy but the first
+func (s dupeSet) wasted() int64 {
+	return int64(len(s)-1) * s[0].info.Size()
+}
+
+// findDupes groups files with identical content, comparing sizes first,
+// then a hash of the start and end of the files, and only then a hash of
+// the whole content
+//
+// Empty files and files that aren't regular are left out, as they waste
+// no space. Hard links to the same file count once, with their other
+// paths kept in links
+func findDupes(files []entry) ([]dupeSet, error) {
+	bySize := map[int64][]*dupeFile{}
+	for _, f := range files {
+		if !f.info.Mode().IsRegular() || f.info.Size() == 0 {
+			continue
+		}
+		linked := false
+		for _, other := range bySize[f.info.Size()] {
+			if sameFile(f.info, other.info) {
+				other.links = append(other.links, f.path)
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			bySize[f.info.Size()] = append(bySize[f.info.Size()], &dupeFile{entry: f})
+		}
+	}
+
+	var sets []dupeSet
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+		byPartial, err := groupByHash(group, partialHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, candidates := range byPartial {
+			if len(candidates) < 2 {
+				continue
+			}
+			byFull, err := groupByHash(candidates, fullHash)
+			if err != nil {
+				return nil, err
+			}
+			for _, set := range byFull {
+				if len(set) > 1 {
+					sets = append(sets, sortSet(set))
+				}
+			}
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		return walkLess(sets[i][0].path, sets[j][0].path)
+	})
+	return sets, nil
+}
+
+// groupByHash splits files into groups with the same hash
+func groupByHash(files []*dupeFile, hash func(entry) ([]byte, error)) (map[string][]*dupeFile, error) {
+	groups := map[string][]*dupeFile{}
+	for _, f := range files {
+		sum, err := hash(f.entry)
+		if err != nil {
+			return nil, err
+		}
+		groups[string(sum)] = append(groups[string(sum)], f)
+	}
+	return groups, nil
+}
+
+// sortSet puts the oldest file first, the one kept by -del and -hardlink,
+// breaking ties by walk order
+func sortSet(files []*dupeFile) dupeSet {
+	set := make(dupeSet, len(files))
+	for i, f := range files {
+		set[i] = *f
+	}
+	sort.Slice(set, func(i, j int) bool {
+		a, b := set[i].info.ModTime(), set[j].info.ModTime()
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return walkLess(set[i].path, set[j].path)
+	})
+	return set
+}
+
+// partialHash hashes the first and last partialSize bytes of a file
+func partialHash(f entry) ([]byte, error) {
+	in, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	h := sha256.New()
+	if _, err := io.CopyN(h, in, partialSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if size := f.info.Size(); size > 2*partialSize {
+		if _, err := io.Copy(h, io.NewSectionReader(in, size-partialSize, partialSize)); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// fullHash hashes the whole content of a file
+func fullHash(f entry) ([]byte, error) {
+	in, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, in); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// reportDupes prints every set of identical files and the space wasted,
+// then deletes or hard links all but the oldest of each set if asked
+func reportDupes(sets []dupeSet, out io.Writer, conf config, d *deleter) error {
+	var total int64
+	for _, set := range sets {
+		fmt.Fprintf(out, "%d identical files of %d bytes, %d bytes wasted:\n", len(set), set[0].info.Size(), set.wasted())
+		for _, f := range set {
+			fmt.Fprintf(out, "  %s\n", f.path)
+			for _, l := range f.links {
+				fmt.Fprintf(out, "  %s (hard link)\n", l)
+			}
+		}
+		total += set.wasted()
+	}
+	fmt.Fprintf(out, "%d sets of duplicates, %d bytes wasted\n", len(sets), total)
+
+	for _, set := range sets {
+		keep := set[0]
+		for _, dup := range set[1:] {
+			// Every link to a duplicate has to go to reclaim its space
+			for _, path := range append([]string{dup.path}, dup.links...) {
+				var err error
+				switch {
+				case conf.hardlink:
+					err = d.link(keep.path, path)
+				case conf.del:
+					err = d.removeDupe(keep.path, path)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// link replaces the file at dup with a hard link to keep, which counts as
+// deleting dup for the policy, dry runs and the log
+func (d *deleter) link(keep, dup string) error {
+	if err := d.policy.check(dup); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dup)
+	if err != nil {
+		return err
+	}
+	if d.dryRun {
+		fmt.Fprintf(d.out, "would link %s to %s (%d bytes)\n", dup, keep, info.Size())
+	} else {
+		// Check the content again in case a file changed since hashing
+		if err := sameContent(keep, dup); err != nil {
+			return fmt.Errorf("cannot link %w", err)
+		}
+		// Link beside the duplicate and rename over it, so it is replaced
+		// in one step and never missing
+		tmp := dup + ".fswalk-link"
+		if err := os.Link(keep, tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dup); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		logf(d.logger, "linked %s to %s (%d bytes)", dup, keep, info.Size())
+	}
+	d.count++
+	d.size += info.Size()
+	return nil
+}
+
+// removeDupe deletes or trashes dup like -del does for any file, once its
+// content is checked again to still match keep
+func (d *deleter) removeDupe(keep, dup string) error {
+	if !d.dryRun {
+		// Check the content again in case a file changed since hashing
+		if err := sameContent(keep, dup); err != nil {
+			return fmt.Errorf("cannot delete %w", err)
+		}
+	}
+	return d.remove(dup)
+}
+
+// sameContent hashes keep and dup again, returning an error if their
+// content no longer matches
+func sameContent(keep, dup string) error {
+	keepSum, err := fullHash(entry{path: keep})
+	if err != nil {
+		return err
+	}
+	dupSum, err := fullHash(entry{path: dup})
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(keepSum, dupSum) {
+		return fmt.Errorf("%s: its content changed since it was compared with %s", dup, keep)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createDupes lays out files where only some are true duplicates, and
+// returns the root
+func createDupes(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	// Same head and tail, different middle, so only the full hash differs
+	big := bytes.Repeat([]byte("x"), 3*partialSize)
+	bigOther := append([]byte{}, big...)
+	bigOther[len(big)/2] = 'y'
+	files := []struct {
+		name string
+		data []byte
+		age  time.Duration
+	}{
+		{"a.txt", []byte("same"), time.Hour},
+		{"sub/a.txt", []byte("same"), 2 * time.Hour},
+		{"c.txt", []byte("diff"), time.Hour},
+		{"big1.bin", big, time.Hour},
+		{"big2.bin", bigOther, time.Hour},
+		{"big3.bin", big, time.Hour},
+		{"empty1", nil, time.Hour},
+		{"empty2", nil, time.Hour},
+	}
+	now := time.Now()
+	for _, f := range files {
+		fpath := filepath.Join(root, filepath.FromSlash(f.name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fpath, f.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fpath, now.Add(-f.age), now.Add(-f.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An existing hard link to a duplicate is reported with it, not as
+	// one more copy
+	if err := os.Link(filepath.Join(root, "a.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestRunDupes(t *testing.T) {
+	root := createDupes(t)
+	var buffer bytes.Buffer
+	if err := run(root, &buffer, config{dupes: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "2 identical files of 12288 bytes, 12288 bytes wasted:\n" +
+		"  " + filepath.Join(root, "big1.bin") + "\n" +
+		"  " + filepath.Join(root, "big3.bin") + "\n" +
+		"2 identical files of 4 bytes, 4 bytes wasted:\n" +
+		"  " + filepath.Join(root, "sub", "a.txt") + "\n" +
+		"  " + filepath.Join(root, "a.txt") + "\n" +
+		"  " + filepath.Join(root, "link.txt") + " (hard link)\n" +
+		"2 sets of duplicates, 12292 bytes wasted\n"
+	if buffer.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buffer.String())
+	}
+}
+
+func TestRunDupesDelete(t *testing.T) {
+	root := createDupes(t)
+	policy, err := newDeletePolicy([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := run(root, io.Discard, config{dupes: true, del: true, policy: policy}); err != nil {
+		t.Fatal(err)
+	}
+	// The oldest of each set is kept, every link to the others goes
+	for _, f := range []string{"sub/a.txt", "big1.bin", "big2.bin", "c.txt"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(f))); err != nil {
+			t.Errorf("Expected %s to be kept: %s", f, err)
+		}
+	}
+	for _, f := range []string{"a.txt", "link.txt", "big3.bin"} {
+		if _, err := os.Stat(filepath.Join(root, f)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", f)
+		}
+	}
+}
+
+func TestRunDupesHardlink(t *testing.T) {
+	root := createDupes(t)
+	policy, err := newDeletePolicy([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run only reports the links
+	var buffer bytes.Buffer
+	conf := config{dupes: true, hardlink: true, dryRun: true, policy: policy}
+	if err := run(root, &buffer, conf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte("would link "+filepath.Join(root, "big3.bin")+" to "+filepath.Join(root, "big1.bin"))) {
+		t.Errorf("Expected the dry run to report the link, got:\n%s", buffer.String())
+	}
+
+	conf.dryRun = false
+	if err := run(root, io.Discard, conf); err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range [][2]string{{"sub/a.txt", "a.txt"}, {"sub/a.txt", "link.txt"}, {"big1.bin", "big3.bin"}} {
+		keep, err := os.Stat(filepath.Join(root, filepath.FromSlash(pair[0])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dup, err := os.Stat(filepath.Join(root, pair[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(keep, dup) {
+			t.Errorf("Expected %s to be a hard link to %s", pair[1], pair[0])
+		}
+	}
+	// Once linked nothing is left to report
+	buffer.Reset()
+	if err := run(root, &buffer, config{dupes: true}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "0 sets of duplicates, 0 bytes wasted\n"; buffer.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buffer.String())
+	}
+}
+
+func TestRunDupesPolicy(t *testing.T) {
+	root := createDupes(t)
+	// Without an allowed root the duplicates can't be removed
+	if err := run(root, io.Discard, config{dupes: true, hardlink: true}); err == nil {
+		t.Errorf("Expected the empty policy to refuse replacing duplicates")
+	}
+}
+
+func TestReportDupesChanged(t *testing.T) {
+	root := createDupes(t)
+	policy, err := newDeletePolicy([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []entry
+	for _, name := range []string{"big1.bin", "big3.bin"} {
+		path := filepath.Join(root, name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, entry{path, info})
+	}
+	sets, err := findDupes(files)
+	if err != nil || len(sets) != 1 {
+		t.Fatalf("Expected one set of duplicates, got %d %v", len(sets), err)
+	}
+	// The duplicate changes between the scan and the delete
+	changed := filepath.Join(root, "big3.bin")
+	if err := os.WriteFile(changed, bytes.Repeat([]byte("z"), 3*partialSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config{dupes: true, del: true, policy: policy}
+	if err := reportDupes(sets, io.Discard, conf, newDeleter(conf, io.Discard)); err == nil {
+		t.Errorf("Expected an error for a duplicate that changed")
+	}
+	if _, err := os.Stat(changed); err != nil {
+		t.Errorf("Expected the changed file to be kept: %s", err)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// predicate type reports whether a file found by the walk is kept. rel
+// is the slash separated path relative to the root
+//
+// Predicates are small and composed with allOf, anyOf and not, so a new
+// filter is a new predicate rather than another argument to thread around
+type predicate func(rel string, info fs.FileInfo) bool
+
+// allOf keeps a file when every predicate keeps it, or none are given
+func allOf(preds ...predicate) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		for _, p := range preds {
+			if !p(rel, info) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// anyOf keeps a file when at least one predicate keeps it
+func anyOf(preds ...predicate) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		for _, p := range preds {
+			if p(rel, info) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// not keeps the files p leaves out
+func not(p predicate) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		return !p(rel, info)
+	}
+}
+
+// isFile keeps everything except directories
+func isFile(rel string, info fs.FileInfo) bool {
+	return !info.IsDir()
+}
+
+// hasExt keeps files with one of the extensions
+func hasExt(exts []string) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		for _, ext := range exts {
+			if filepath.Ext(rel) == ext {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// minSize keeps files of at least size bytes
+func minSize(size int64) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		return info.Size() >= size
+	}
+}
+
+// maxSize keeps files of at most size bytes
+func maxSize(size int64) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		return info.Size() <= size
+	}
+}
+
+// modifiedBefore keeps files last modified before t
+func modifiedBefore(t time.Time) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		return info.ModTime().Before(t)
+	}
+}
+
+// modifiedAfter keeps files last modified after t
+func modifiedAfter(t time.Time) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		return info.ModTime().After(t)
+	}
+}
+
+// modes maps the names accepted by -mode to their predicate
+var modes = map[string]predicate{
+	"executable": func(rel string, info fs.FileInfo) bool {
+		return info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+	},
+	"empty": func(rel string, info fs.FileInfo) bool {
+		return info.Mode().IsRegular() && info.Size() == 0
+	},
+	"symlink": func(rel string, info fs.FileInfo) bool {
+		return info.Mode()&fs.ModeSymlink != 0
+	},
+}
+
+// globAny keeps files matching any of the glob patterns
+func globAny(patterns []string) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		for _, p := range patterns {
+			if matchGlob(p, rel) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// regexAny keeps files whose name matches any of the expressions
+func regexAny(res []*regexp.Regexp) predicate {
+	return func(rel string, info fs.FileInfo) bool {
+		for _, re := range res {
+			if re.MatchString(path.Base(rel)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchGlob reports whether the slash separated path rel matches
+// pattern. Patterns without a slash match the file name in any directory,
+// the others match the whole path relative to the root
+func matchGlob(pattern, rel string) bool {
+	name := rel
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(rel)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// pruneDir reports whether the directory at rel matches one of the
+// patterns, so the walk skips everything below it
+func pruneDir(rel string, patterns []string) bool {
+	return globAny(patterns)(rel, nil)
+}
+
+// attrFilter type holds the metadata filters that make up one group,
+// a zero field means the filter isn't used
+type attrFilter struct {
+	minSize   int64
+	maxSize   int64
+	olderThan time.Duration
+	newerThan time.Duration
+	modes     []string
+}
+
+// predicate combines the filters of the group with AND, relative to now
+func (a attrFilter) predicate(now time.Time) predicate {
+	var preds []predicate
+	if a.minSize > 0 {
+		preds = append(preds, minSize(a.minSize))
+	}
+	if a.maxSize > 0 {
+		preds = append(preds, maxSize(a.maxSize))
+	}
+	if a.olderThan > 0 {
+		preds = append(preds, modifiedBefore(now.Add(-a.olderThan)))
+	}
+	if a.newerThan > 0 {
+		preds = append(preds, modifiedAfter(now.Add(-a.newerThan)))
+	}
+	for _, m := range a.modes {
+		preds = append(preds, modes[m])
+	}
+	return allOf(preds...)
+}
+
+// empty reports whether the group has no filters, and so keeps everything
+func (a attrFilter) empty() bool {
+	return a.minSize == 0 && a.maxSize == 0 && a.olderThan == 0 && a.newerThan == 0 && len(a.modes) == 0
+}
+
+// filter builds the predicate for the filters in conf
+//
+// Every filter must keep a file, except for the metadata filters when
+// -or groups are given: then the file must match the flags' own group
+// or any of the -or groups
+func (conf config) filter(now time.Time) predicate {
+	preds := []predicate{isFile}
+	if len(conf.ext) > 0 {
+		preds = append(preds, hasExt(conf.ext))
+	}
+	if len(conf.include) > 0 {
+		preds = append(preds, globAny(conf.include))
+	}
+	if len(conf.exclude) > 0 {
+		preds = append(preds, not(globAny(conf.exclude)))
+	}
+	if len(conf.regex) > 0 {
+		preds = append(preds, regexAny(conf.regex))
+	}
+	if len(conf.excludeRegex) > 0 {
+		preds = append(preds, not(regexAny(conf.excludeRegex)))
+	}
+
+	flags := attrFilter{
+		minSize:   conf.size,
+		maxSize:   conf.maxSize,
+		olderThan: conf.olderThan,
+		newerThan: conf.newerThan,
+		modes:     conf.modes,
+	}
+	if len(conf.or) == 0 {
+		return allOf(append(preds, flags.predicate(now))...)
+	}
+	var groups []predicate
+	if !flags.empty() {
+		groups = append(groups, flags.predicate(now))
+	}
+	for _, g := range conf.or {
+		groups = append(groups, g.predicate(now))
+	}
+	return allOf(append(preds, anyOf(groups...))...)
+}
+
+// parseAge parses a duration like time.ParseDuration, also accepting
+// whole days and weeks such as 30d or 2w
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			count, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// parseMode checks the name of a -mode filter
+func parseMode(name string) (string, error) {
+	if _, ok := modes[name]; !ok {
+		return "", fmt.Errorf("unknown mode %q, use executable, empty or symlink", name)
+	}
+	return name, nil
+}
+
+// parseGroup parses an -or group of comma separated key=value filters,
+// such as "older-than=30d,size=1024" or "mode=empty"
+func parseGroup(s string) (attrFilter, error) {
+	var a attrFilter
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return a, fmt.Errorf("invalid filter %q in group %q, use key=value", field, s)
+		}
+		var err error
+		switch key {
+		case "size":
+			a.minSize, err = strconv.ParseInt(value, 10, 64)
+		case "max-size":
+			a.maxSize, err = strconv.ParseInt(value, 10, 64)
+		case "older-than":
+			a.olderThan, err = parseAge(value)
+		case "newer-than":
+			a.newerThan, err = parseAge(value)
+		case "mode":
+			var m string
+			if m, err = parseMode(value); err == nil {
+				a.modes = append(a.modes, m)
+			}
+		default:
+			err = fmt.Errorf("unknown filter %q", key)
+		}
+		if err != nil {
+			return a, fmt.Errorf("invalid group %q: %w", s, err)
+		}
+	}
+	return a, nil
+}
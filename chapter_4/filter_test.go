@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	// Create anonymous slice of struct with test case definitions
+	testCases := []struct {
+		name     string
+		file     string
+		conf     config
+		expected bool
+	}{
+		{"FilterNoExtension", "testdata/dir.log", config{}, true},
+		{"FilterExtensionMatch", "testdata/dir.log", config{ext: []string{".log"}}, true},
+		{"FilterExtensionNoMatch", "testdata/dir.log", config{ext: []string{".sh"}}, false},
+		{"FilterExtensionSizeMatch", "testdata/dir.log", config{ext: []string{".log"}, size: 10}, true},
+		{"FilterExtensionSizeNoMatch", "testdata/dir.log", config{ext: []string{".log"}, size: 20}, false},
+		{"FilterMultipleExtensionMatch", "testdata/dir.log", config{ext: []string{".sh", ".log"}}, true},
+		{"FilterMaxSizeMatch", "testdata/dir.log", config{maxSize: 20}, true},
+		{"FilterMaxSizeNoMatch", "testdata/dir.log", config{maxSize: 5}, false},
+		{"FilterSizeRangeNoMatch", "testdata/dir.log", config{size: 1, maxSize: 5}, false},
+		{"FilterDirectory", "testdata/dir2", config{}, false},
+	}
+	// Iterate over the testCases object and run the test
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := os.Lstat(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := tc.conf.filter(time.Now())(tc.file, info)
+			if result != tc.expected {
+				t.Errorf("Expected:\n\t%t\nGot:\n\t%t", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestFilterAttributes(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		data string
+		perm os.FileMode
+		age  time.Duration
+	}{
+		{"old.log", "dummy", 0644, 40 * 24 * time.Hour},
+		{"new.log", "dummy", 0644, time.Hour},
+		{"empty.log", "", 0644, time.Hour},
+		{"run.sh", "#!/bin/sh\n", 0755, 40 * 24 * time.Hour},
+	}
+	for _, f := range files {
+		fpath := filepath.Join(dir, f.name)
+		if err := os.WriteFile(fpath, []byte(f.data), f.perm); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-f.age)
+		if err := os.Chtimes(fpath, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("old.log", filepath.Join(dir, "link.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		conf     config
+		expected []string
+	}{
+		{"OlderThan", config{olderThan: 30 * 24 * time.Hour}, []string{"old.log", "run.sh"}},
+		{"NewerThan", config{newerThan: 24 * time.Hour}, []string{"empty.log", "link.log", "new.log"}},
+		{"Executable", config{modes: []string{"executable"}}, []string{"run.sh"}},
+		{"Empty", config{modes: []string{"empty"}}, []string{"empty.log"}},
+		{"Symlink", config{modes: []string{"symlink"}}, []string{"link.log"}},
+		{"And", config{olderThan: 30 * 24 * time.Hour, ext: []string{".log"}}, []string{"old.log"}},
+		{
+			"OrGroups",
+			config{modes: []string{"executable"}, or: []attrFilter{{modes: []string{"empty"}}, {minSize: 5, newerThan: 24 * time.Hour}}},
+			// The symlink is new and its own size is the length of its target
+			[]string{"empty.log", "link.log", "new.log", "run.sh"},
+		},
+		{
+			"OrGroupsWithAnd",
+			config{ext: []string{".log"}, or: []attrFilter{{modes: []string{"empty"}}, {modes: []string{"executable"}}}},
+			[]string{"empty.log"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keep := tc.conf.filter(now)
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kept []string
+			for _, e := range entries {
+				info, err := e.Info()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if keep(e.Name(), info) {
+					kept = append(kept, e.Name())
+				}
+			}
+			if len(kept) != len(tc.expected) {
+				t.Fatalf("Expected:\n\t%q\nGot:\n\t%q", tc.expected, kept)
+			}
+			for idx := range kept {
+				if kept[idx] != tc.expected[idx] {
+					t.Errorf("Expected:\n\t%q\nGot:\n\t%q", tc.expected, kept)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+		err      bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"xd", 0, true},
+		{"-1h", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			d, err := parseAge(tc.value)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error %t, got %v", tc.err, err)
+			}
+			if d != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, d)
+			}
+		})
+	}
+}
+
+func TestParseGroup(t *testing.T) {
+	g, err := parseGroup("older-than=30d, size=10,mode=empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.olderThan != 30*24*time.Hour || g.minSize != 10 || len(g.modes) != 1 || g.modes[0] != "empty" {
+		t.Errorf("Unexpected group %+v", g)
+	}
+	for _, bad := range []string{"older-than", "color=red", "mode=fifo", "size=big"} {
+		if _, err := parseGroup(bad); err == nil {
+			t.Errorf("Expected error for group %q", bad)
+		}
+	}
+}
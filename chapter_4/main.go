@@ -1,28 +1,111 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // config type is used to package arguments in a custom type
 // this helps prevent too many positional arguments,
 // which would become hard to read
 type config struct {
-	// File extensions to filter out
-	ext string
-	// Min file size
-	size int64
+	// File extensions to keep, any of them matches
+	ext []string
+	// Glob patterns a file must match one of, and must match none of
+	include []string
+	exclude []string
+	// Regular expressions a file name must match one of, and none of
+	regex        []*regexp.Regexp
+	excludeRegex []*regexp.Regexp
+	// Glob patterns of directories to skip without walking into them
+	prune []string
+	// Min and max file size, 0 leaves the max out
+	size    int64
+	maxSize int64
+	// Keep files last modified more, or less, than this long ago
+	olderThan time.Duration
+	newerThan time.Duration
+	// File modes a file must have: executable, empty or symlink
+	modes []string
+	// Alternative groups of metadata filters, a file matching any group
+	// or the filters above is kept
+	or []attrFilter
 	// List files
 	list bool
 	// delete files
 	del bool
+	// Directory matched files are archived into before anything else
+	archive string
+	// Archive into one tar.gz instead of a .gz per file
+	tarball bool
+	// Decides which files -del may remove
+	policy deletePolicy
+	// Print what -del would delete instead of deleting
+	dryRun bool
+	// Directory -del moves files into instead of deleting them
+	trash string
+	// Audit log of archived, deleted and trashed files, may be nil
+	logger *log.Logger
+	// File the audit log is written to, never acted on by the walk
+	logName string
+	// Report sets of identical files instead of acting on each file,
+	// -del and -hardlink then remove all but the oldest of each set
+	dupes    bool
+	hardlink bool
+	// Goroutines reading directories, 1 walks with filepath.Walk, which
+	// is faster unless the file system is slow to answer
+	workers int
+	// Act on files in the order filepath.Walk finds them when walking
+	// with several workers
+	ordered bool
+}
+
+// errConflict is returned for flags that can't be used together
+var errConflict = errors.New("conflicting flags")
+
+// validate reports flags that contradict each other, rather than letting
+// one of them win silently
+func (c config) validate() error {
+	var modes []string
+	if c.list {
+		modes = append(modes, "-list")
+	}
+	if c.dupes {
+		modes = append(modes, "-dupes")
+	}
+	if c.archive != "" {
+		modes = append(modes, "-archive")
+	}
+	if len(modes) > 1 {
+		return fmt.Errorf("%w: %s can't be combined", errConflict, strings.Join(modes, ", "))
+	}
+	if c.hardlink && !c.dupes {
+		return fmt.Errorf("%w: -hardlink only works with -dupes", errConflict)
+	}
+	if c.hardlink && c.del {
+		return fmt.Errorf("%w: -hardlink and -del can't be combined", errConflict)
+	}
+	return nil
 }
 
 func main() {
+	// Subcommands have their own flags
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := restoreCmd(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	// Override the default help/info message
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(),
@@ -30,6 +113,7 @@ func main() {
 			os.Args[0],
 		)
 		fmt.Fprintf(flag.CommandLine.Output(), "Adapted in October 2022\n")
+		fmt.Fprintln(flag.CommandLine.Output(), "Subcommands: restore TRASHDIR puts trashed files back")
 		fmt.Fprintln(flag.CommandLine.Output(), "Usage information:")
 		flag.PrintDefaults()
 	}
@@ -38,19 +122,97 @@ func main() {
 	// Action flags
 	list := flag.Bool("list", false, "List files only")
 	del := flag.Bool("del", false, "Delete files")
+	archive := flag.String("archive", "", "Archive files into this directory, before deleting them with -del")
+	tarball := flag.Bool("tar", false, "Use with -archive to write one tar.gz instead of a .gz per file")
+	var allow, protect stringList
+	flag.Var(&allow, "allow", "Absolute directory -del may delete below, can be repeated. "+
+		"Defaults to $FSWALK_ALLOW, a list like $PATH, or the temporary directory")
+	flag.Var(&protect, "protect", "Path -del never deletes, or deletes below, can be repeated")
+	dryRun := flag.Bool("dry-run", false, "Use with -del to print what would be deleted and the space reclaimed")
+	trash := flag.String("trash", "", "Use with -del to move files into a dated directory below this one instead")
+	logFile := flag.String("log", "", "Log archived, deleted and trashed files to this file")
+	dupes := flag.Bool("dupes", false, "Report sets of identical files and the space wasted, "+
+		"with -del delete all but the oldest of each set")
+	hardlink := flag.Bool("hardlink", false, "Use with -dupes to replace all but the oldest of each set with hard links")
+	// Walk flags
+	workers := flag.Int("workers", 1, "Number of directories read concurrently, "+
+		"helps most on high-latency file systems such as network mounts")
+	ordered := flag.Bool("sort", false, "Use with -workers to act on files in the same order as a single worker")
 	// Filter flags
-	ext := flag.String("ext", "", "File extensions to filter out")
+	var ext, include, exclude, regex, excludeRegex, prune stringList
+	flag.Var(&ext, "ext", "File extension to filter for, can be repeated")
 	size := flag.Int64("size", 0, "Minimum file size")
+	flag.Var(&include, "include", "Glob pattern files must match, can be repeated")
+	flag.Var(&exclude, "exclude", "Glob pattern of files to leave out, can be repeated")
+	flag.Var(&regex, "regex", "Regular expression file names must match, can be repeated")
+	flag.Var(&excludeRegex, "exclude-regex", "Regular expression of file names to leave out, can be repeated")
+	flag.Var(&prune, "prune", "Glob pattern of directories not to walk into, like node_modules, can be repeated")
+	maxSize := flag.Int64("max-size", 0, "Maximum file size, 0 for no maximum")
+	// Parsed as they are set, so mistakes are reported with the usage
+	var c config
+	flag.Func("older-than", "Keep files modified longer ago than this, such as 30d, 2w or 12h", func(s string) (err error) {
+		c.olderThan, err = parseAge(s)
+		return err
+	})
+	flag.Func("newer-than", "Keep files modified more recently than this, such as 30d, 2w or 12h", func(s string) (err error) {
+		c.newerThan, err = parseAge(s)
+		return err
+	})
+	flag.Func("mode", "Keep executable, empty or symlink files, can be repeated to require several", func(s string) error {
+		m, err := parseMode(s)
+		c.modes = append(c.modes, m)
+		return err
+	})
+	flag.Func("or", "Alternative group of size, max-size, older-than, newer-than and mode filters, "+
+		"such as older-than=30d,size=1024. Files matching any group, or the filter flags, are kept. Can be repeated",
+		func(s string) error {
+			g, err := parseGroup(s)
+			c.or = append(c.or, g)
+			return err
+		})
 	flag.Parse()
-	// Create an instance of the config struct to store flag info
-	c := config{
-		ext:  *ext,
-		size: *size,
-		list: *list,
-		del:  *del,
+	// Store the rest of the flag info in the config
+	c.ext = ext
+	c.size = *size
+	c.maxSize = *maxSize
+	c.list = *list
+	c.del = *del
+	c.archive = *archive
+	c.tarball = *tarball
+	c.dryRun = *dryRun
+	c.trash = *trash
+	c.dupes = *dupes
+	c.hardlink = *hardlink
+	c.workers = *workers
+	c.ordered = *ordered
+	c.include = include
+	c.exclude = exclude
+	c.prune = prune
+	// Check the patterns up front rather than failing halfway through a walk
+	var err error
+	if err = checkGlobs(include, exclude, prune); err == nil {
+		if c.regex, err = compileAll(regex); err == nil {
+			c.excludeRegex, err = compileAll(excludeRegex)
+		}
+	}
+	if err == nil && (c.del || c.hardlink) {
+		c.policy, err = newDeletePolicy(allowedRoots(allow), protect)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	logger, closeLog, err := openLog(*logFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	c.logger = logger
+	c.logName = *logFile
 	// Call run
-	if err := run(*root, os.Stdout, c); err != nil {
+	err = run(*root, os.Stdout, c)
+	closeLog()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -58,27 +220,177 @@ func main() {
 
 // run defines the logic to descend into the directory and find all
 // sub-directories and files within it
-func run(root string, out io.Writer, conf config) error {
-	return filepath.Walk(root,
-		// filepath.Walk requires a function to know what to do once
-		// files are found. We use the first-class property of go
-		// functions to hand an anonymoust function to filepath.Walk
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if filterOut(path, conf.ext, conf.size, info) {
-				return nil
+//
+// With more than one worker the tree is read concurrently. Files being
+// archived are collected during the walk, and only deleted once the
+// archive has been written and verified. Files checked for duplicates
+// are collected too, as they can only be compared once all are found
+func run(root string, out io.Writer, conf config) (err error) {
+	if err := conf.validate(); err != nil {
+		return err
+	}
+	keep := conf.filter(time.Now())
+	// The trash is created up front, so it is known before the walk
+	// reaches it if it is below the root
+	if conf.trash != "" && conf.del && !conf.dryRun {
+		if err := os.MkdirAll(conf.trash, 0755); err != nil {
+			return err
+		}
+	}
+	// Stat what the walk leaves alone once, and compare every entry's
+	// own FileInfo with it, so the walk costs no extra stat calls
+	avoidDirs := statAll(conf.archive, conf.trash)
+	avoidFiles := statAll(conf.logName)
+	w := walker{
+		skip: func(path string, info os.FileInfo) bool {
+			if pruneDir(relPath(root, path), conf.prune) {
+				return true
 			}
-			// If list was set, just return the listed files
-			if conf.list {
-				return listFile(path, out)
+			// Never archive or trash the archive or trash when they are below the root
+			return sameAny(info, avoidDirs)
+		},
+		match: func(path string, info os.FileInfo) bool {
+			// The log can't record its own deletion
+			if !info.IsDir() && sameAny(info, avoidFiles) {
+				return false
 			}
-			if conf.del {
-				return delFile(path)
+			return keep(relPath(root, path), info)
+		},
+	}
+	var archived []string
+	var found []entry
+	d := newDeleter(conf, out)
+	defer func() {
+		if finishErr := d.finish(); err == nil {
+			err = finishErr
+		}
+	}()
+	act := func(e entry) error {
+		// If list was set, just return the listed files
+		if conf.list {
+			return listFile(e.path, out)
+		}
+		if conf.dupes {
+			found = append(found, e)
+			return nil
+		}
+		if conf.archive != "" {
+			archived = append(archived, e.path)
+			return nil
+		}
+		if conf.del {
+			return d.remove(e.path)
+		}
+		// By default, just list the files
+		return listFile(e.path, out)
+	}
+	if conf.workers > 1 {
+		err = w.walkParallel(root, conf.workers, conf.ordered, act)
+	} else {
+		err = w.walk(root, act)
+	}
+	if err != nil {
+		return err
+	}
+	if conf.dupes {
+		sets, err := findDupes(found)
+		if err != nil {
+			return err
+		}
+		return reportDupes(sets, out, conf, d)
+	}
+	if len(archived) == 0 {
+		return nil
+	}
+
+	// A failed or corrupt archive stops here, before any file is deleted
+	archives, err := archiveFiles(conf.archive, root, archived, conf.tarball)
+	if err != nil {
+		return err
+	}
+	for _, a := range archives {
+		logf(conf.logger, "archived to %s", a)
+	}
+	for _, path := range archived {
+		if conf.del {
+			err = d.remove(path)
+		} else {
+			err = listFile(path, out)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stringList type collects the values of a flag that can be repeated
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// checkGlobs returns an error for the first malformed glob pattern
+func checkGlobs(lists ...[]string) error {
+	for _, patterns := range lists {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", p, err)
 			}
-			// By default, just list the files
-			return listFile(path, out)
-		})
+		}
+	}
+	return nil
+}
+
+// compileAll compiles every expression, returning the first error
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// relPath returns path relative to root with forward slashes, so glob
+// patterns work the same on every OS
+func relPath(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// statAll stats every path that is set and exists, following symlinks
+func statAll(paths ...string) []os.FileInfo {
+	var infos []os.FileInfo
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if info, err := os.Stat(p); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
 
+// sameAny reports whether info describes the same file as any of infos
+func sameAny(info os.FileInfo, infos []os.FileInfo) bool {
+	for _, other := range infos {
+		if sameFile(info, other) {
+			return true
+		}
+	}
+	return false
 }
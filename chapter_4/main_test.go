@@ -2,6 +2,11 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -16,7 +21,7 @@ func TestRun(t *testing.T) {
 			name: "NoFilter",
 			root: "testdata",
 			conf: config{
-				ext:  "",
+				ext:  nil,
 				size: 0,
 				list: true,
 			},
@@ -26,7 +31,7 @@ func TestRun(t *testing.T) {
 			name: "FilterExtensionMatch",
 			root: "testdata",
 			conf: config{
-				ext:  ".log",
+				ext:  []string{".log"},
 				size: 0,
 				list: true,
 			},
@@ -36,7 +41,7 @@ func TestRun(t *testing.T) {
 			name: "FilterExtensionSizeMatch",
 			root: "testdata",
 			conf: config{
-				ext:  ".log",
+				ext:  []string{".log"},
 				size: 10,
 				list: true,
 			},
@@ -46,7 +51,7 @@ func TestRun(t *testing.T) {
 			name: "FilterExtensionSizeNoMatch",
 			root: "testdata",
 			conf: config{
-				ext:  ".log",
+				ext:  []string{".log"},
 				size: 20,
 				list: true,
 			},
@@ -56,7 +61,7 @@ func TestRun(t *testing.T) {
 			name: "FilterExtensionNoMatch",
 			root: "testdata",
 			conf: config{
-				ext:  ".gz",
+				ext:  []string{".gz"},
 				size: 0,
 				list: true},
 			expected: "",
@@ -81,6 +86,91 @@ func TestRun(t *testing.T) {
 	}
 }
 
+// createTree creates the files, given as slash separated paths, in a
+// temporary directory and returns the directory
+func createTree(t *testing.T, files []string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, f := range files {
+		fpath := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestRunNameFilters(t *testing.T) {
+	root := createTree(t, []string{
+		"a.log", "b.txt", "c.go", "c_test.go",
+		"src/d.go", "src/e.log",
+		"node_modules/pkg/f.go", ".git/config",
+	})
+	testCases := []struct {
+		name     string
+		conf     config
+		expected []string
+	}{
+		{
+			name:     "RepeatedExtension",
+			conf:     config{ext: []string{".log", ".txt"}},
+			expected: []string{"a.log", "b.txt", "src/e.log"},
+		},
+		{
+			name:     "IncludeGlob",
+			conf:     config{include: []string{"*.go"}, prune: []string{"node_modules"}},
+			expected: []string{"c.go", "c_test.go", "src/d.go"},
+		},
+		{
+			name:     "IncludePathGlob",
+			conf:     config{include: []string{"src/*"}},
+			expected: []string{"src/d.go", "src/e.log"},
+		},
+		{
+			name:     "ExcludeGlob",
+			conf:     config{ext: []string{".go"}, exclude: []string{"*_test.go"}, prune: []string{"node_modules"}},
+			expected: []string{"c.go", "src/d.go"},
+		},
+		{
+			name:     "Regex",
+			conf:     config{regex: []*regexp.Regexp{regexp.MustCompile(`^[ab]\.`)}},
+			expected: []string{"a.log", "b.txt"},
+		},
+		{
+			name: "ExcludeRegex",
+			conf: config{
+				ext:          []string{".go", ".log"},
+				excludeRegex: []*regexp.Regexp{regexp.MustCompile(`_test|^e`)},
+				prune:        []string{"node_modules"},
+			},
+			expected: []string{"a.log", "c.go", "src/d.go"},
+		},
+		{
+			name:     "Prune",
+			conf:     config{prune: []string{"node_modules", ".git", "src"}},
+			expected: []string{"a.log", "b.txt", "c.go", "c_test.go"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := run(root, &buffer, tc.conf); err != nil {
+				t.Fatal(err)
+			}
+			var expected strings.Builder
+			for _, f := range tc.expected {
+				expected.WriteString(filepath.Join(root, filepath.FromSlash(f)) + "\n")
+			}
+			if expected.String() != buffer.String() {
+				t.Errorf("Expected:\n\t%q\nGot:\n\t%q", expected.String(), buffer.String())
+			}
+		})
+	}
+}
+
 // func createTempDir(t *testing.T, files map[string]int) (dirname string, cleanup func()) {
 // 	t.Helper()
 
@@ -99,3 +189,28 @@ func TestRun(t *testing.T) {
 // 	}
 // 	return tempDir, func() { os.RemoveAll(tempDir) }
 // }
+
+func TestRunConflictingFlags(t *testing.T) {
+	root := createTree(t, []string{"a.log"})
+	testCases := []struct {
+		name string
+		cfg  config
+	}{
+		{"ListDupes", config{list: true, dupes: true}},
+		{"ListArchive", config{list: true, archive: t.TempDir()}},
+		{"DupesArchive", config{dupes: true, archive: t.TempDir()}},
+		{"HardlinkWithoutDupes", config{hardlink: true}},
+		{"HardlinkDel", config{dupes: true, hardlink: true, del: true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := run(root, &buffer, tc.cfg); !errors.Is(err, errConflict) {
+				t.Errorf("Expected error %q, got %v", errConflict, err)
+			}
+			if buffer.Len() != 0 {
+				t.Errorf("Expected no output, got %q", buffer.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// errNotAllowed is returned for paths outside every allowed root
+	errNotAllowed = errors.New("outside the allowed delete roots")
+	// errProtected is returned for protected paths and their contents
+	errProtected = errors.New("protected path")
+)
+
+// defaultProtected lists system directories that are never deleted from,
+// whatever the allowed roots are
+var defaultProtected = []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/proc", "/sbin", "/sys", "/usr"}
+
+// deletePolicy type decides which paths delFile may remove
+//
+// Both lists hold absolute paths with symlinks resolved, so paths are
+// compared after the same resolution and neither ".." nor a symlinked
+// directory can lead outside an allowed root
+type deletePolicy struct {
+	allow []string
+	deny  []string
+}
+
+// newDeletePolicy resolves the allowed roots, which must be absolute,
+// and the protected paths, which are added to defaultProtected
+func newDeletePolicy(allow, protect []string) (deletePolicy, error) {
+	var p deletePolicy
+	for _, root := range allow {
+		if !filepath.IsAbs(root) {
+			return p, fmt.Errorf("allowed root %q must be an absolute path", root)
+		}
+		resolved, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return p, fmt.Errorf("allowed root %q: %w", root, err)
+		}
+		p.allow = append(p.allow, resolved)
+	}
+	for _, path := range append(append([]string{}, defaultProtected...), protect...) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return p, err
+		}
+		// Protected paths don't have to exist on every system
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		p.deny = append(p.deny, abs)
+	}
+	return p, nil
+}
+
+// check returns an error unless path may be deleted
+//
+// The directory holding path is resolved, but not path itself: deleting
+// a symlink removes the link, never what it points to
+func (p deletePolicy) check(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return fmt.Errorf("cannot delete %s: %w", path, err)
+	}
+	resolved := filepath.Join(dir, filepath.Base(abs))
+	for _, denied := range p.deny {
+		if resolved == denied || within(denied, resolved) {
+			return fmt.Errorf("cannot delete %s: %w %s", path, errProtected, denied)
+		}
+	}
+	for _, root := range p.allow {
+		if within(root, resolved) {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot delete %s: %w %s", path, errNotAllowed, strings.Join(p.allow, ", "))
+}
+
+// within reports whether path is below dir, both absolute and clean
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// allowedRoots returns the roots from the -allow flags, or else from the
+// FSWALK_ALLOW list, or else the system temporary directory
+func allowedRoots(flags []string) []string {
+	if len(flags) > 0 {
+		return flags
+	}
+	if env := os.Getenv("FSWALK_ALLOW"); env != "" {
+		return filepath.SplitList(env)
+	}
+	return []string{os.TempDir()}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// manifestName is the file in a trash directory recording where each
+// trashed file came from, one JSON entry per line
+const manifestName = "manifest.jsonl"
+
+// trashEntry type is one line of a trash manifest
+type trashEntry struct {
+	// Absolute path the file was moved from
+	Original string `json:"original"`
+	// Slash separated path of the file inside the trash directory
+	Trashed string    `json:"trashed"`
+	Size    int64     `json:"size"`
+	Time    time.Time `json:"time"`
+}
+
+// trashCan type moves files into a dated directory below root, created
+// on the first move so runs that trash nothing leave nothing behind
+type trashCan struct {
+	root string
+	// Dated directory of this run and its open manifest
+	dir      string
+	manifest *os.File
+}
+
+// put moves the file at path into the trash, recording it in the
+// manifest, and returns where it was moved to
+//
+// The manifest line is written first, so a file in the trash is always
+// listed even if the move or the run fails halfway
+func (t *trashCan) put(path string, size int64) (string, error) {
+	if t.dir == "" {
+		if err := os.MkdirAll(t.root, 0755); err != nil {
+			return "", err
+		}
+		dir, err := os.MkdirTemp(t.root, time.Now().Format("2006-01-02T15-04-05")+"-")
+		if err != nil {
+			return "", err
+		}
+		manifest, err := os.OpenFile(filepath.Join(dir, manifestName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return "", err
+		}
+		t.dir, t.manifest = dir, manifest
+	}
+	original, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// Mirror the original path, so files with the same name don't collide
+	rel := strings.TrimPrefix(filepath.ToSlash(original[len(filepath.VolumeName(original)):]), "/")
+	trashed := filepath.Join(t.dir, "files", filepath.FromSlash(rel))
+	entry, err := json.Marshal(trashEntry{Original: original, Trashed: "files/" + rel, Size: size, Time: time.Now()})
+	if err != nil {
+		return "", err
+	}
+	if _, err := t.manifest.Write(append(entry, '\n')); err != nil {
+		return "", err
+	}
+	return trashed, moveFile(original, trashed)
+}
+
+// close closes the manifest of this run, if anything was trashed
+func (t *trashCan) close() error {
+	if t.manifest == nil {
+		return nil
+	}
+	return t.manifest.Close()
+}
+
+// moveFile renames src to dst, creating dst's directory, and falls back
+// to copying when they are on different file systems
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("cannot move %s: %s already exists", src, dst)
+	}
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst with its mode and modification time,
+// copying symlinks as links
+func copyFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// restoreCmd parses the restore subcommand flags and puts the files of
+// a trash directory back where they came from
+func restoreCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	logFile := fs.String("log", "", "Log restored files to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("restore: give one dated trash directory")
+	}
+	logger, closeLog, err := openLog(*logFile)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	return restore(fs.Arg(0), out, logger)
+}
+
+// restore moves every file listed in the manifest of the trash directory
+// dir back to its original path
+//
+// Files whose original path is taken again are left in the trash and
+// reported. Entries for files that never reached the trash, because the
+// move failed after the manifest was written, are dropped. The manifest
+// is rewritten to list only what is left, and only the directories
+// emptied by the restore are removed, so files the manifest doesn't
+// list are never lost
+func restore(dir string, out io.Writer, logger *log.Logger) error {
+	f, err := os.Open(filepath.Join(dir, manifestName))
+	if err != nil {
+		return err
+	}
+	var entries []trashEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e trashEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			f.Close()
+			return fmt.Errorf("%s: corrupt manifest: %w", dir, err)
+		}
+		entries = append(entries, e)
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var left []trashEntry
+	var failed []string
+	for _, e := range entries {
+		trashed := filepath.Join(dir, filepath.FromSlash(e.Trashed))
+		if _, err := os.Lstat(trashed); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Lstat(e.Original); err == nil {
+				continue
+			}
+		}
+		if err := moveFile(trashed, e.Original); err != nil {
+			left = append(left, e)
+			failed = append(failed, err.Error())
+			continue
+		}
+		logf(logger, "restored %s", e.Original)
+		fmt.Fprintln(out, e.Original)
+	}
+	if err := removeEmptyDirs(filepath.Join(dir, "files")); err != nil {
+		return err
+	}
+	if len(left) == 0 {
+		if err := os.Remove(filepath.Join(dir, manifestName)); err != nil {
+			return err
+		}
+		if err := os.Remove(dir); err != nil {
+			return fmt.Errorf("restore: %s holds files missing from the manifest, left in place: %w", dir, err)
+		}
+		return nil
+	}
+	var manifest strings.Builder
+	for _, e := range left {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		manifest.Write(append(line, '\n'))
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestName), []byte(manifest.String()), 0644); err != nil {
+		return err
+	}
+	return fmt.Errorf("restore: %d files left in %s:\n%s", len(left), dir, strings.Join(failed, "\n"))
+}
+
+// removeEmptyDirs removes root and the directories below it that are
+// empty, deepest first, leaving any directory that still holds a file
+func removeEmptyDirs(root string) error {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for n := len(dirs) - 1; n >= 0; n-- {
+		// Fails for directories that aren't empty, which are kept
+		os.Remove(dirs[n])
+	}
+	return nil
+}
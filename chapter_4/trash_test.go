@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRunDryRun(t *testing.T) {
+	root := createTree(t, []string{"a.log", "sub/b.log", "c.txt"})
+	policy, err := newDeletePolicy([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	conf := config{ext: []string{".log"}, del: true, dryRun: true, policy: policy}
+	if err := run(root, &buffer, conf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "would delete " + filepath.Join(root, "a.log") + " (5 bytes)\n" +
+		"would delete " + filepath.Join(root, "sub", "b.log") + " (5 bytes)\n" +
+		"would reclaim 10 bytes from 2 files\n"
+	if buffer.String() != expected {
+		t.Errorf("Expected:\n\t%q\nGot:\n\t%q", expected, buffer.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.log")); err != nil {
+		t.Errorf("Expected a dry run to keep a.log: %s", err)
+	}
+}
+
+func TestRunDryRunPolicy(t *testing.T) {
+	root := createTree(t, []string{"a.log"})
+	// A dry run still reports what the policy would refuse
+	conf := config{del: true, dryRun: true}
+	if err := run(root, io.Discard, conf); err == nil {
+		t.Errorf("Expected the empty policy to refuse the delete")
+	}
+}
+
+func TestRunLog(t *testing.T) {
+	root := createTree(t, []string{"a.log"})
+	policy, err := newDeletePolicy([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logBuffer bytes.Buffer
+	conf := config{del: true, policy: policy, logger: log.New(&logBuffer, "", log.LstdFlags)}
+	if err := run(root, io.Discard, conf); err != nil {
+		t.Fatal(err)
+	}
+	expected := regexp.MustCompile(`^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d deleted ` +
+		regexp.QuoteMeta(filepath.Join(root, "a.log")) + ` \(5 bytes\)\n$`)
+	if !expected.MatchString(logBuffer.String()) {
+		t.Errorf("Unexpected log:\n%s", logBuffer.String())
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	root := createTree(t, []string{"a.log", "sub/b.log"})
+	policy, err := newDeletePolicy([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The trash below the root must not be walked into
+	trash := filepath.Join(root, ".trash")
+	var logBuffer bytes.Buffer
+	conf := config{del: true, trash: trash, policy: policy, logger: log.New(&logBuffer, "", 0)}
+	if err := run(root, io.Discard, conf); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"a.log", "sub/b.log"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(f))); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be moved to the trash", f)
+		}
+	}
+	if !strings.HasPrefix(logBuffer.String(), "trashed "+filepath.Join(root, "a.log")+" to "+trash) {
+		t.Errorf("Unexpected log:\n%s", logBuffer.String())
+	}
+	dirs, err := filepath.Glob(filepath.Join(trash, "*"))
+	if err != nil || len(dirs) != 1 {
+		t.Fatalf("Expected one dated trash directory, got %v %v", dirs, err)
+	}
+
+	// A file recreated at its original path is left in the trash
+	if err := os.WriteFile(filepath.Join(root, "a.log"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := restoreCmd([]string{dirs[0]}, &buffer); err == nil {
+		t.Fatal("Expected an error for a file that can't be restored")
+	}
+	if expected := filepath.Join(root, "sub", "b.log") + "\n"; buffer.String() != expected {
+		t.Errorf("Expected:\n\t%q\nGot:\n\t%q", expected, buffer.String())
+	}
+	data, err := os.ReadFile(filepath.Join(root, "sub", "b.log"))
+	if err != nil || string(data) != "dummy" {
+		t.Errorf("Expected b.log to be restored, got %q %v", data, err)
+	}
+
+	// Once the conflict is gone the rest comes back and the trash is emptied
+	if err := os.Remove(filepath.Join(root, "a.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreCmd([]string{dirs[0]}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(filepath.Join(root, "a.log"))
+	if err != nil || string(data) != "dummy" {
+		t.Errorf("Expected a.log to be restored, got %q %v", data, err)
+	}
+	if _, err := os.Stat(dirs[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected the emptied trash directory to be removed")
+	}
+}
+
+func TestRestoreKeepsUnlisted(t *testing.T) {
+	root := createTree(t, []string{"a.log", "c.txt"})
+	dir := filepath.Join(t.TempDir(), "trash")
+	can := &trashCan{root: dir}
+	if _, err := can.put(filepath.Join(root, "a.log"), 5); err != nil {
+		t.Fatal(err)
+	}
+	// A file moved without its manifest line, and a manifest line whose
+	// move never happened
+	unlisted := filepath.Join(can.dir, "files", "unlisted.log")
+	if err := os.WriteFile(unlisted, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := json.Marshal(trashEntry{Original: filepath.Join(root, "c.txt"), Trashed: "files/c.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := can.manifest.Write(append(entry, '\n')); err != nil {
+		t.Fatal(err)
+	}
+	if err := can.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := restore(can.dir, &buffer, nil); err == nil {
+		t.Errorf("Expected an error for the file missing from the manifest")
+	}
+	if expected := filepath.Join(root, "a.log") + "\n"; buffer.String() != expected {
+		t.Errorf("Expected:\n\t%q\nGot:\n\t%q", expected, buffer.String())
+	}
+	for _, f := range []string{filepath.Join(root, "a.log"), filepath.Join(root, "c.txt"), unlisted} {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("Expected %s to exist: %s", f, err)
+		}
+	}
+}
+
+func TestRunSkipsLog(t *testing.T) {
+	root := createTree(t, []string{"a.log"})
+	policy, err := newDeletePolicy([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logName := filepath.Join(root, "audit.log")
+	logger, closeLog, err := openLog(logName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := config{del: true, policy: policy, logger: logger, logName: logName}
+	err = run(root, io.Discard, conf)
+	closeLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(logName)
+	if err != nil {
+		t.Fatalf("Expected the log to be kept: %s", err)
+	}
+	if !strings.Contains(string(data), "deleted "+filepath.Join(root, "a.log")) {
+		t.Errorf("Unexpected log:\n%s", data)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errStopped tells the workers the walk was stopped early
+var errStopped = errors.New("walk stopped")
+
+// entry type is a file matched by the walk
+type entry struct {
+	path string
+	info fs.FileInfo
+}
+
+// walker type holds what both walks need to decide which directories to
+// enter and which files to hand on
+type walker struct {
+	// skip reports whether the directory at path, below the root, is
+	// left out along with everything in it
+	skip func(path string, info fs.FileInfo) bool
+	// match reports whether the file at path is handed on. The parallel
+	// walk calls it from several goroutines at once
+	match func(path string, info fs.FileInfo) bool
+	// read lists a directory for the parallel walk, os.ReadDir when nil
+	read func(dir string) ([]fs.DirEntry, error)
+}
+
+// walk calls fn for every matched file below root using filepath.Walk
+func (w walker) walk(root string, fn func(entry) error) error {
+	return filepath.Walk(root,
+		// filepath.Walk requires a function to know what to do once
+		// files are found. We use the first-class property of go
+		// functions to hand an anonymoust function to filepath.Walk
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// Skip whole subtrees, but never the root the user asked for
+			if info.IsDir() && path != root && w.skip(path, info) {
+				return filepath.SkipDir
+			}
+			if !w.match(path, info) {
+				return nil
+			}
+			return fn(entry{path, info})
+		})
+}
+
+// walkParallel calls fn for every matched file below root, reading
+// directories with os.ReadDir in a pool of workers goroutines
+//
+// Files are handed to fn as they are found, or once the walk is done in
+// the order filepath.Walk would find them when ordered is set. fn is
+// never called concurrently, and an error from it stops the walk
+//
+// Entries are only Lstat'ed when skip, match or fn asks for more than
+// their name and type, so the pool pays off where reading a directory
+// waits on the file system, see BenchmarkWalkLatency
+func (w walker) walkParallel(root string, workers int, ordered bool, fn func(entry) error) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if w.match(root, info) {
+			return fn(entry{root, info})
+		}
+		return nil
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu   sync.Mutex
+		cond = sync.NewCond(&mu)
+		// Directories waiting to be read, and those queued or being read
+		queue   = []string{root}
+		pending = 1
+		walkErr error
+	)
+	found := make(chan entry, workers*16)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				for len(queue) == 0 && pending > 0 && walkErr == nil {
+					cond.Wait()
+				}
+				if len(queue) == 0 || walkErr != nil {
+					mu.Unlock()
+					return
+				}
+				// Taking the newest directory keeps the queue short
+				dir := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				mu.Unlock()
+
+				subdirs, err := w.readDir(dir, found, done)
+				mu.Lock()
+				if err != nil && walkErr == nil {
+					walkErr = err
+				}
+				queue = append(queue, subdirs...)
+				pending += len(subdirs) - 1
+				// Wake the others for the new directories, or to finish
+				cond.Broadcast()
+				mu.Unlock()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	var entries []entry
+	var fnErr error
+	for e := range found {
+		if fnErr != nil {
+			// Drain what the workers already found so they can exit
+			continue
+		}
+		if ordered {
+			entries = append(entries, e)
+			continue
+		}
+		if fnErr = fn(e); fnErr != nil {
+			mu.Lock()
+			walkErr = errStopped
+			cond.Broadcast()
+			mu.Unlock()
+			close(done)
+		}
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return walkLess(entries[i].path, entries[j].path)
+	})
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir sends the matched files in dir to found and returns the
+// subdirectories to walk into
+func (w walker) readDir(dir string, found chan<- entry, done <-chan struct{}) ([]string, error) {
+	read := w.read
+	if read == nil {
+		read = os.ReadDir
+	}
+	dirEntries, err := read(dir)
+	if err != nil {
+		return nil, err
+	}
+	var subdirs []string
+	for _, d := range dirEntries {
+		path := filepath.Join(dir, d.Name())
+		info := &dirEntryInfo{DirEntry: d}
+		if d.IsDir() {
+			if !w.skip(path, info) {
+				subdirs = append(subdirs, path)
+			}
+		} else if w.match(path, info) {
+			select {
+			case found <- entry{path, info}:
+			case <-done:
+				return nil, errStopped
+			}
+		}
+		if errors.Is(info.err, fs.ErrNotExist) {
+			// Removed since the directory was read
+			continue
+		}
+		if info.err != nil {
+			return nil, info.err
+		}
+	}
+	return subdirs, nil
+}
+
+// dirEntryInfo type is the fs.FileInfo of a directory entry. The name
+// and type come from the directory read, and the entry is only Lstat'ed
+// the first time anything else is asked for
+type dirEntryInfo struct {
+	fs.DirEntry
+	info fs.FileInfo
+	err  error
+}
+
+// stat returns the Lstat of the entry, or nil if it failed
+func (i *dirEntryInfo) stat() fs.FileInfo {
+	if i.info == nil && i.err == nil {
+		i.info, i.err = i.DirEntry.Info()
+	}
+	return i.info
+}
+
+// Size returns the length in bytes, 0 if the Lstat failed
+func (i *dirEntryInfo) Size() int64 {
+	if info := i.stat(); info != nil {
+		return info.Size()
+	}
+	return 0
+}
+
+// Mode returns the mode bits, only the type if the Lstat failed
+func (i *dirEntryInfo) Mode() fs.FileMode {
+	if info := i.stat(); info != nil {
+		return info.Mode()
+	}
+	return i.Type()
+}
+
+// ModTime returns the modification time, zero if the Lstat failed
+func (i *dirEntryInfo) ModTime() time.Time {
+	if info := i.stat(); info != nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// Sys returns the Lstat's underlying data, nil if it failed
+func (i *dirEntryInfo) Sys() any {
+	if info := i.stat(); info != nil {
+		return info.Sys()
+	}
+	return nil
+}
+
+// sameFile is os.SameFile for FileInfos from either walk
+func sameFile(a, b fs.FileInfo) bool {
+	a, b = lstatInfo(a), lstatInfo(b)
+	return a != nil && b != nil && os.SameFile(a, b)
+}
+
+// lstatInfo returns the Lstat behind info, which is info itself unless
+// it is a directory entry not stat'ed yet. It is nil if the Lstat failed
+func lstatInfo(info fs.FileInfo) fs.FileInfo {
+	if lazy, ok := info.(*dirEntryInfo); ok {
+		return lazy.stat()
+	}
+	return info
+}
+
+// walkLess orders paths the way filepath.Walk visits them, which is
+// comparing one path element at a time so "a/b" comes before "a.txt"
+//
+// That is the same as comparing bytes with the separator sorting before
+// everything else, which avoids splitting paths for every comparison
+func walkLess(a, b string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		if a[i] == filepath.Separator {
+			return true
+		}
+		if b[i] == filepath.Separator {
+			return false
+		}
+		return a[i] < b[i]
+	}
+	return len(a) < len(b)
+}
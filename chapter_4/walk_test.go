@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// walkTree lists files in a layout where sorting whole paths and walking
+// give different orders
+var walkTree = []string{
+	"a.txt", "a/b.log", "a/c/d.txt", "a-b/e.log", "b.log",
+	"node_modules/x/f.txt", "z/y/x/w.log", "z/y.txt",
+}
+
+func TestRunParallel(t *testing.T) {
+	root := createTree(t, walkTree)
+	confs := map[string]config{
+		"NoFilter": {},
+		"Filters":  {ext: []string{".log"}, prune: []string{"node_modules"}},
+	}
+	for name, conf := range confs {
+		t.Run(name, func(t *testing.T) {
+			var serial bytes.Buffer
+			if err := run(root, &serial, conf); err != nil {
+				t.Fatal(err)
+			}
+			for _, workers := range []int{2, 8} {
+				// Ordered output matches filepath.Walk exactly
+				var ordered bytes.Buffer
+				conf.workers, conf.ordered = workers, true
+				if err := run(root, &ordered, conf); err != nil {
+					t.Fatal(err)
+				}
+				if ordered.String() != serial.String() {
+					t.Errorf("Expected with %d workers:\n\t%q\nGot:\n\t%q", workers, serial.String(), ordered.String())
+				}
+				// Unordered output has the same files in any order
+				var unordered bytes.Buffer
+				conf.ordered = false
+				if err := run(root, &unordered, conf); err != nil {
+					t.Fatal(err)
+				}
+				got := strings.Split(unordered.String(), "\n")
+				sort.Strings(got)
+				expected := strings.Split(serial.String(), "\n")
+				sort.Strings(expected)
+				if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+					t.Errorf("Expected with %d workers:\n\t%q\nGot:\n\t%q", workers, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWalkParallelStop(t *testing.T) {
+	root := createTree(t, walkTree)
+	w := walker{
+		skip:  func(string, fs.FileInfo) bool { return false },
+		match: func(path string, info os.FileInfo) bool { return !info.IsDir() },
+	}
+	stop := errors.New("stop")
+	calls := 0
+	err := w.walkParallel(root, 4, false, func(entry) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("Expected the error from fn, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected fn not to be called after an error, got %d calls", calls)
+	}
+}
+
+func TestWalkParallelFile(t *testing.T) {
+	root := createTree(t, []string{"a.log"})
+	var buffer bytes.Buffer
+	file := filepath.Join(root, "a.log")
+	if err := run(file, &buffer, config{workers: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != file+"\n" {
+		t.Errorf("Expected %q, got %q", file+"\n", buffer.String())
+	}
+}
+
+func TestWalkLess(t *testing.T) {
+	paths := []string{"a.txt", "a/b", "a-b/c", "a", "a/b/c", "b"}
+	sort.Slice(paths, func(i, j int) bool {
+		return walkLess(filepath.FromSlash(paths[i]), filepath.FromSlash(paths[j]))
+	})
+	expected := "a a/b a/b/c a-b/c a.txt b"
+	if got := strings.Join(paths, " "); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+// benchTree creates a tree of dirs directories with files files each
+func benchTree(b *testing.B, dirs, files int) string {
+	b.Helper()
+	root := b.TempDir()
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%d", d/10), fmt.Sprintf("sub%d", d))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.log", f)), []byte("dummy"), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func BenchmarkRunWalk(b *testing.B) {
+	root := benchTree(b, 200, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := run(root, io.Discard, config{ext: []string{".log"}}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunParallel(b *testing.B) {
+	root := benchTree(b, 200, 50)
+	for _, workers := range []int{2, 4, 8, 16} {
+		for _, ordered := range []bool{false, true} {
+			b.Run(fmt.Sprintf("workers=%d/sort=%t", workers, ordered), func(b *testing.B) {
+				conf := config{ext: []string{".log"}, workers: workers, ordered: ordered}
+				for i := 0; i < b.N; i++ {
+					if err := run(root, io.Discard, conf); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkWalk compares filepath.Walk with the os.ReadDir worker pool
+// on a real tree, with no work done per file, so only the walks count
+//
+// On a local disk with the tree in the page cache every read returns at
+// once, so the workers have little to overlap, see BenchmarkWalkLatency
+// for a file system where each read waits
+func BenchmarkWalk(b *testing.B) {
+	root := benchTree(b, 200, 50)
+	w := walker{
+		skip:  func(string, fs.FileInfo) bool { return false },
+		match: func(path string, info os.FileInfo) bool { return !info.IsDir() },
+	}
+	noop := func(entry) error { return nil }
+	b.Run("filepath.Walk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := w.walk(root, noop); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	for _, workers := range []int{1, 4, 16} {
+		for _, ordered := range []bool{false, true} {
+			b.Run(fmt.Sprintf("ReadDir/workers=%d/sort=%t", workers, ordered), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := w.walkParallel(root, workers, ordered, noop); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkWalkLatency is BenchmarkWalk on a file system where reading a
+// directory takes a millisecond, as on a network mount, which is where
+// the workers pay off
+func BenchmarkWalkLatency(b *testing.B) {
+	root := benchTree(b, 100, 10)
+	w := walker{
+		skip:  func(string, fs.FileInfo) bool { return false },
+		match: func(path string, info os.FileInfo) bool { return !info.IsDir() },
+		read: func(dir string) ([]fs.DirEntry, error) {
+			time.Sleep(time.Millisecond)
+			return os.ReadDir(dir)
+		},
+	}
+	noop := func(entry) error { return nil }
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := w.walkParallel(root, workers, false, noop); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}